@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"log"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/worker"
+	"github.com/spf13/cobra"
+	"github.com/streadway/amqp"
+)
+
+var wrkrCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "manages the worker queues",
+}
+
+var replayLimit int
+
+var replayDLQCmd = &cobra.Command{
+	Use:   "replay-dlq",
+	Short: "moves dead letters back to the worker queue",
+	Long: `Moves the messages dead lettered after running out of attempts back
+to the worker queue with a fresh set of attempts, once the cause of their
+failure is fixed. --limit replays only the oldest ones.`,
+	RunE: replayDLQ,
+}
+
+func init() {
+	replayDLQCmd.Flags().IntVar(&replayLimit, "limit", 0, "number of dead letters to replay, every one when 0")
+	wrkrCmd.AddCommand(replayDLQCmd)
+}
+
+func replayDLQ(cmd *cobra.Command, args []string) error {
+	wrkrCnf := config.GetWorker()
+
+	conn, err := amqp.Dial(wrkrCnf.Rabbit.URL)
+	if err != nil {
+		log.Println("error connecting rabbitmq ", err)
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		log.Println("error opening channel ", err)
+		return err
+	}
+	defer ch.Close()
+
+	n, err := worker.ReplayDeadLetters(ch, wrkrCnf.Rabbit.QueueName, replayLimit)
+	log.Printf("replayed %d dead letters of %s\n", n, worker.DeadLetterQueueName(wrkrCnf.Rabbit.QueueName))
+
+	return err
+}
@@ -11,5 +11,5 @@ var mgrtnCmd = &cobra.Command{
 }
 
 func init() {
-	mgrtnCmd.AddCommand(migration.MgrtnUP, migration.MgrtnDOWN)
+	mgrtnCmd.AddCommand(migration.MgrtnUP, migration.MgrtnDOWN, migration.MgrtnStatus, migration.MgrtnSynonyms, migration.MgrtnReindex)
 }
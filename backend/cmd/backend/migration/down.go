@@ -10,14 +10,26 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// MgrtnDOWN migrates up the db
+var downSteps int
+
+// MgrtnDOWN migrates down the db
 var MgrtnDOWN = &cobra.Command{
 	Use:   "down",
 	Short: "migrates down database schema",
-	RunE:  down,
+	Long: `Reverts the last applied migrations, latest first, and removes their
+records from the migration index.`,
+	RunE: down,
+}
+
+func init() {
+	MgrtnDOWN.Flags().IntVar(&downSteps, "steps", 1, "number of applied migrations to revert")
 }
 
 func down(cmd *cobra.Command, args []string) error {
+	if downSteps < 1 {
+		return fmt.Errorf("--steps must be at least 1, got %d", downSteps)
+	}
+
 	cnf := config.GetApp()
 	fmt.Printf("loaded config => %+v\n", cnf)
 
@@ -28,5 +40,5 @@ func down(cmd *cobra.Command, args []string) error {
 	}
 	log.Println("connected elasticSearch")
 
-	return repo.MigrateDown(es)
+	return repo.MigrateDown(cmd.Context(), es, downSteps)
 }
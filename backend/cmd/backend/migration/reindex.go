@@ -0,0 +1,46 @@
+package migration
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/infra"
+	"github.com/BackAged/go-elasticsearch-react/backend/repo"
+	"github.com/spf13/cobra"
+)
+
+var rollback bool
+
+// MgrtnReindex moves indices into new versions built from the current mappings
+var MgrtnReindex = &cobra.Command{
+	Use:   "reindex [repo...]",
+	Short: "reindexes into new index versions without downtime",
+	Long: `Creates the next version of every named index (every index when none is
+named) from the current settings and mappings, copies the documents into it,
+checks the document counts and switches the aliases. The previous version is
+kept, --rollback switches reads and writes back to it.`,
+	RunE: reindex,
+}
+
+func init() {
+	MgrtnReindex.Flags().BoolVar(&rollback, "rollback", false, "switch back to the previous index versions")
+}
+
+func reindex(cmd *cobra.Command, args []string) error {
+	cnf := config.GetApp()
+	fmt.Printf("loaded config => %+v\n", cnf)
+
+	log.Println("connecting elasticSearch")
+	es, err := infra.NewEsClient(cnf.ElasticSearchURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("connected elasticSearch")
+
+	if rollback {
+		return repo.Rollback(cmd.Context(), es, args...)
+	}
+
+	return repo.Reindex(cmd.Context(), es, args...)
+}
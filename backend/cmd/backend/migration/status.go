@@ -0,0 +1,49 @@
+package migration
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/infra"
+	"github.com/BackAged/go-elasticsearch-react/backend/repo"
+	"github.com/spf13/cobra"
+)
+
+// MgrtnStatus lists the migrations and whether they are applied
+var MgrtnStatus = &cobra.Command{
+	Use:   "status",
+	Short: "lists applied and pending migrations",
+	RunE:  status,
+}
+
+func status(cmd *cobra.Command, args []string) error {
+	cnf := config.GetApp()
+
+	log.Println("connecting elasticSearch")
+	es, err := infra.NewEsClient(cnf.ElasticSearchURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("connected elasticSearch")
+
+	states, err := repo.MigrationStatus(cmd.Context(), es)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tAPPLIED AT\tDESCRIPTION")
+	for _, s := range states {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, appliedAt, s.Description)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/infra"
+	"github.com/BackAged/go-elasticsearch-react/backend/repo"
+	"github.com/spf13/cobra"
+)
+
+// MgrtnSynonyms loads a synonyms file into the catalog analyzers
+var MgrtnSynonyms = &cobra.Command{
+	Use:   "synonyms <file>",
+	Short: "loads synonyms and reloads the search analyzers",
+	Long: `Validates the solr formatted synonyms file, installs it in ES_ANALYSIS_DIR
+(the analysis directory shared with every elasticsearch node) and reloads the
+search analyzers of the catalog indices, searches keep being served meanwhile.`,
+	Args: cobra.ExactArgs(1),
+	RunE: synonyms,
+}
+
+func synonyms(cmd *cobra.Command, args []string) error {
+	cnf := config.GetApp()
+	fmt.Printf("loaded config => %+v\n", cnf)
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rules, err := repo.ParseSynonyms(f)
+	if err != nil {
+		return fmt.Errorf("invalid synonyms file %s: %w", args[0], err)
+	}
+
+	// write next to the target and rename, so nodes never read half a file
+	dst := filepath.Join(cnf.AnalysisDir, filepath.Base(repo.SynonymsFile))
+	tmp, err := ioutil.TempFile(cnf.AnalysisDir, ".synonyms-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strings.Join(rules, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return err
+	}
+	log.Printf("installed %d synonym rules in %s\n", len(rules), dst)
+
+	log.Println("connecting elasticSearch")
+	es, err := infra.NewEsClient(cnf.ElasticSearchURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("connected elasticSearch")
+
+	return repo.ReloadSynonyms(cmd.Context(), es)
+}
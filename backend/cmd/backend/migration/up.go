@@ -10,11 +10,19 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var upTo int
+
 // MgrtnUP migrates up the db
 var MgrtnUP = &cobra.Command{
 	Use:   "up",
 	Short: "migrates up database schema",
-	RunE:  up,
+	Long: `Applies the pending migrations in order and records each in the
+migration index, --to stops after the given version.`,
+	RunE: up,
+}
+
+func init() {
+	MgrtnUP.Flags().IntVar(&upTo, "to", 0, "last migration version to apply, every pending one when 0")
 }
 
 func up(cmd *cobra.Command, args []string) error {
@@ -28,5 +36,5 @@ func up(cmd *cobra.Command, args []string) error {
 	}
 	log.Println("connected elasticSearch")
 
-	return repo.MigrateUp(es)
+	return repo.MigrateUp(cmd.Context(), es, upTo)
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -42,14 +43,53 @@ func serveRest(cmd *cobra.Command, args []string) error {
 	prdRepo := repo.NewProductRepo(es, repo.RepoNameProduct)
 	brndRepo := repo.NewBrandRepo(es, repo.RepoNameBrand)
 	shpRepo := repo.NewShopRepo(es, repo.RepoNameShop)
+	ctgRepo := repo.NewCategoryRepo(es, repo.RepoNameCategory)
+	sgstRepo := repo.NewSuggestRepo(es, prdRepo, brndRepo, shpRepo, ctgRepo)
 
 	// initiating services
-	svc := search.NewService(prdRepo, brndRepo, shpRepo)
+	svc := search.NewService(prdRepo, brndRepo, shpRepo, ctgRepo, sgstRepo, serviceConfig(cnf))
+	trckr := search.NewTracker(prdRepo, trackerConfig(cnf))
+
+	trckrCtx, stopTrckr := context.WithCancel(cmd.Context())
+	defer stopTrckr()
+	trckrDone := make(chan struct{})
+	go func() {
+		defer close(trckrDone)
+		trckr.Run(trckrCtx)
+	}()
+
+	// without a keys file the key protected routes stay locked until one
+	// is added and reloaded
+	keys, err := config.LoadAPIKeys(cnf.APIKeysFile)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("warning: api keys file %s is missing, key protected routes reject every request\n", cnf.APIKeysFile)
+		keys, err = nil, nil
+	}
+	if err != nil {
+		log.Println("error loading api keys ", err)
+		return err
+	}
+	ks, err := rest.NewKeyStore(keys)
+	if err != nil {
+		log.Println("error loading api keys ", err)
+		return err
+	}
+	if err := reloadRankFeatures(prdRepo, cnf.RankingFile); err != nil {
+		log.Println("error loading rank features ", err)
+		return err
+	}
+	go reloadOnHUP(
+		func() error { return reloadAPIKeys(ks, cnf.APIKeysFile) },
+		func() error { return reloadRankFeatures(prdRepo, cnf.RankingFile) },
+	)
 
 	// inittiating handler
-	brndHndlr := rest.NewBrandHandler(svc)
-	shpHndlr := rest.NewShopHandler(svc)
-	prdHndlr := rest.NewProductHandler(svc)
+	brndHndlr := rest.NewBrandHandler(svc, ks)
+	shpHndlr := rest.NewShopHandler(svc, ks)
+	prdHndlr := rest.NewProductHandler(svc, ks)
+	ctgHndlr := rest.NewCategoryHandler(svc, ks)
+	evntHndlr := rest.NewEventHandler(trckr, ks)
+	sgstHndlr := rest.NewSuggestHandler(svc, ks)
 
 	r := chi.NewRouter()
 	r.Use(chiMiddleware.Logger)
@@ -60,6 +100,9 @@ func serveRest(cmd *cobra.Command, args []string) error {
 	r.Mount("/api/v1/search/brand", brndHndlr.Router())
 	r.Mount("/api/v1/search/shop", shpHndlr.Router())
 	r.Mount("/api/v1/search/product", prdHndlr.Router())
+	r.Mount("/api/v1/search/category", ctgHndlr.Router())
+	r.Mount("/api/v1/search/event", evntHndlr.Router())
+	r.Mount("/api/v1/search/suggest", sgstHndlr.Router())
 
 	timeout := 30 * time.Second
 	srvr := http.Server{
@@ -73,8 +116,6 @@ func serveRest(cmd *cobra.Command, args []string) error {
 
 	errCh := make(chan error)
 
-	sigs := []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGKILL, syscall.SIGTERM, os.Interrupt}
-
 	graceful := func() error {
 		log.Println("Shutting down server gracefully with in", timeout)
 		log.Println("To shutdown immediately press again")
@@ -82,7 +123,13 @@ func serveRest(cmd *cobra.Command, args []string) error {
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 
-		return srvr.Shutdown(ctx)
+		err := srvr.Shutdown(ctx)
+
+		// flush the events tracked so far
+		stopTrckr()
+		<-trckrDone
+
+		return err
 	}
 
 	forced := func() error {
@@ -98,38 +145,52 @@ func serveRest(cmd *cobra.Command, args []string) error {
 	}()
 
 	go func() {
-		errCh <- HandleSignals(sigs, graceful, forced)
+		errCh <- HandleSignals(shutdownSignals, graceful, forced)
 	}()
 
 	return <-errCh
 }
 
-// HandleSignals listen on the registered signals and fires the gracefulHandler for the
-// first signal and the forceHandler (if any) for the next this function blocks and
-// return any error that returned by any of the handlers first
-func HandleSignals(sigs []os.Signal, gracefulHandler, forceHandler func() error) error {
-	sigCh := make(chan os.Signal)
-	errCh := make(chan error, 1)
+// reloadOnHUP runs every reload on every SIGHUP, so api keys and rank
+// features can be changed without restarting the server. A failing reload
+// keeps the current values.
+func reloadOnHUP(reloads ...func() error) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+	for range hupCh {
+		for _, reload := range reloads {
+			if err := reload(); err != nil {
+				log.Println("error reloading, keeping the current values: ", err)
+			}
+		}
+	}
+}
 
-	signal.Notify(sigCh, sigs...)
-	defer signal.Stop(sigCh)
+// reloadAPIKeys re-reads the api keys file, so keys can be added, expired
+// or revoked
+func reloadAPIKeys(ks *rest.KeyStore, path string) error {
+	keys, err := config.LoadAPIKeys(path)
+	if err != nil {
+		return err
+	}
+	if err := ks.Replace(keys); err != nil {
+		return err
+	}
+	log.Printf("reloaded %d api keys\n", len(keys))
 
-	grace := true
+	return nil
+}
 
-	select {
-	case err := <-errCh:
+// reloadRankFeatures re-reads the ranking file, so merchandisers can tune
+// the weights of the rank features
+func reloadRankFeatures(prdRepo repo.ProductRepo, path string) error {
+	fts, err := config.LoadRankFeatures(path)
+	if err != nil {
 		return err
-	case <-sigCh:
-		if grace {
-			grace = false
-			go func() {
-				errCh <- gracefulHandler()
-			}()
-		} else if forceHandler != nil {
-			err := forceHandler()
-			errCh <- err
-		}
 	}
+	prdRepo.SetRankFeatures(fts)
+	log.Printf("loaded %d rank features\n", len(fts))
 
 	return nil
 }
@@ -3,7 +3,10 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
 	"github.com/spf13/cobra"
 )
 
@@ -18,6 +21,7 @@ var (
 func init() {
 	RootCmd.AddCommand(serveRestCmd)
 	RootCmd.AddCommand(srvWrkr)
+	RootCmd.AddCommand(wrkrCmd)
 	RootCmd.AddCommand(mgrtnCmd)
 }
 
@@ -29,3 +33,24 @@ func Execute() {
 		os.Exit(1)
 	}
 }
+
+// serviceConfig returns the search service config
+func serviceConfig(cnf *config.Application) search.Config {
+	return search.Config{
+		Timeouts: search.Timeouts{
+			Search: time.Duration(cnf.SearchTimeout) * time.Second,
+			Write:  time.Duration(cnf.WriteTimeout) * time.Second,
+		},
+		PriceRanges: cnf.PriceRanges,
+	}
+}
+
+// trackerConfig returns the click stream tracker config
+func trackerConfig(cnf *config.Application) search.TrackerConfig {
+	return search.TrackerConfig{
+		HalfLife:      time.Duration(cnf.PopularityHalfLife) * time.Hour,
+		FlushInterval: time.Duration(cnf.PopularityFlushInterval) * time.Second,
+		MaxPending:    cnf.PopularityMaxPending,
+		DedupWindow:   time.Duration(cnf.PopularityDedupWindow) * time.Minute,
+	}
+}
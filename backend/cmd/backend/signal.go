@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// shutdownSignals stop the servers, gracefully on the first and forcefully on the next
+var shutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, os.Interrupt}
+
+// HandleSignals listen on the registered signals and fires the gracefulHandler for the
+// first signal and the forceHandler (if any) for the next this function blocks and
+// return any error that returned by any of the handlers first
+func HandleSignals(sigs []os.Signal, gracefulHandler, forceHandler func() error) error {
+	sigCh := make(chan os.Signal, 1)
+	errCh := make(chan error, 1)
+
+	signal.Notify(sigCh, sigs...)
+	defer signal.Stop(sigCh)
+
+	grace := true
+
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-sigCh:
+			if grace {
+				grace = false
+				go func() {
+					errCh <- gracefulHandler()
+				}()
+			} else if forceHandler != nil {
+				return forceHandler()
+			}
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/BackAged/go-elasticsearch-react/backend/config"
 	"github.com/BackAged/go-elasticsearch-react/backend/infra"
@@ -11,6 +13,7 @@ import (
 	"github.com/BackAged/go-elasticsearch-react/backend/worker"
 	"github.com/BackAged/steadyrabbit"
 	"github.com/spf13/cobra"
+	"github.com/streadway/amqp"
 )
 
 var srvWrkr = &cobra.Command{
@@ -35,9 +38,10 @@ func serveWorker(cmd *cobra.Command, args []string) error {
 	prdRepo := repo.NewProductRepo(es, repo.RepoNameProduct)
 	brndRepo := repo.NewBrandRepo(es, repo.RepoNameBrand)
 	shpRepo := repo.NewShopRepo(es, repo.RepoNameShop)
+	ctgRepo := repo.NewCategoryRepo(es, repo.RepoNameCategory)
 
 	// initiating services
-	svc := search.NewService(prdRepo, brndRepo, shpRepo)
+	svc := search.NewService(prdRepo, brndRepo, shpRepo, ctgRepo, repo.NewSuggestRepo(es, prdRepo, brndRepo, shpRepo, ctgRepo), serviceConfig(cnf))
 	hndlr := worker.NewHandler(svc)
 
 	srCnf := &steadyrabbit.Config{
@@ -70,12 +74,134 @@ func serveWorker(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	wrkr := worker.NewWorker(wrkrCnf.ConcurrencyCount, cnsmr)
+	plcy := retryPolicy(wrkrCnf)
+	if err := declareRetryTopology(wrkrCnf.Rabbit.URL, wrkrCnf.Rabbit.QueueName, plcy); err != nil {
+		log.Println("error declaring retry topology ", err)
+		return err
+	}
+
+	dlyPub, err := steadyrabbit.NewPublisher(&steadyrabbit.Config{URL: wrkrCnf.Rabbit.URL})
+	if err != nil {
+		log.Println("error initializing retry publisher ", err)
+		return err
+	}
+	dlPub, err := steadyrabbit.NewPublisher(&steadyrabbit.Config{
+		URL: wrkrCnf.Rabbit.URL,
+		Publisher: &steadyrabbit.PublisherConfig{
+			Exchange: &steadyrabbit.ExchangeConfig{
+				ExchangeName: worker.DeadLetterExchangeName(wrkrCnf.Rabbit.QueueName),
+			},
+		},
+	})
+	if err != nil {
+		log.Println("error initializing dead letter publisher ", err)
+		return err
+	}
+
+	wrkr := worker.NewWorker(wrkrCnf.ConcurrencyCount, time.Duration(wrkrCnf.TaskTimeout)*time.Second, cnsmr, worker.Retry{
+		Policy:     plcy,
+		Queue:      wrkrCnf.Rabbit.QueueName,
+		Delay:      dlyPub,
+		DeadLetter: dlPub,
+	})
+
+	if err := wrkr.SetUpRouter(hndlr, worker.BatchConfig{
+		MaxDocs: wrkrCnf.BatchSize,
+		Window:  time.Duration(wrkrCnf.BatchWindow) * time.Millisecond,
+	}); err != nil {
+		log.Println("error setting up router ", err)
+		return err
+	}
+
+	timeout := time.Duration(cnf.GracefulTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	graceful := func() error {
+		log.Println("Shutting down worker gracefully with in", timeout)
+		log.Println("To shutdown immediately press again")
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		return wrkr.Stop(ctx)
+	}
+
+	forced := func() error {
+		log.Println("Shutting down worker forcefully")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
 
-	err = wrkr.SetUpRouter(hndlr)
+		return wrkr.Stop(ctx)
+	}
+
+	if wrkrCnf.StatsInterval > 0 {
+		go logWorkerStats(cmd.Context(), wrkr, time.Duration(wrkrCnf.StatsInterval)*time.Second)
+	}
 
-	err = wrkr.Start()
+	// the worker returns once it stops consuming, the handler once its
+	// running tasks are drained
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- wrkr.Start(cmd.Context())
+	}()
+	go func() {
+		errCh <- HandleSignals(shutdownSignals, graceful, forced)
+	}()
+
+	if err := <-errCh; err != nil {
+		log.Println("worker shutdown with ", err)
+		return err
+	}
+	err = <-errCh
 	log.Println("worker shutdown with ", err)
 
+	dlyPub.Close()
+	dlPub.Close()
+
 	return err
 }
+
+// retryPolicy returns the retry policy of the worker
+func retryPolicy(cnf *config.Worker) worker.RetryPolicy {
+	return worker.RetryPolicy{
+		MaxAttempts: cnf.Retry.MaxAttempts,
+		BaseDelay:   time.Duration(cnf.Retry.BaseDelay) * time.Second,
+		MaxDelay:    time.Duration(cnf.Retry.MaxDelay) * time.Second,
+	}
+}
+
+// declareRetryTopology declares the delay and dead letter queues of queue
+func declareRetryTopology(url string, queue string, plcy worker.RetryPolicy) error {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return worker.DeclareRetryTopology(ch, queue, plcy)
+}
+
+// logWorkerStats logs how busy the consumers of wrkr are every interval
+func logWorkerStats(ctx context.Context, wrkr *worker.Worker, interval time.Duration) {
+	tckr := time.NewTicker(interval)
+	defer tckr.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tckr.C:
+			st := wrkr.Stats()
+			log.Printf("worker consumers: %d active, %d idle of %d\n", st.Active, st.Idle, st.Consumers)
+		}
+	}
+}
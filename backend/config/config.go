@@ -1,8 +1,14 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -16,7 +22,22 @@ var workerOnce = sync.Once{}
 type Worker struct {
 	Name             string `yaml:"name"`
 	ConcurrencyCount int    `yaml:"concurrency_count"`
-	Rabbit           Rabbit
+	// TaskTimeout and StatsInterval are in seconds
+	TaskTimeout   int `yaml:"task_timeout"`
+	StatsInterval int `yaml:"stats_interval"`
+	// BatchSize is in documents, BatchWindow in milliseconds
+	BatchSize   int `yaml:"batch_size"`
+	BatchWindow int `yaml:"batch_window"`
+	Rabbit      Rabbit
+	Retry       Retry
+}
+
+// Retry defines how often and how late the worker retries a failed message,
+// delays are in seconds
+type Retry struct {
+	MaxAttempts int `yaml:"max_attempts"`
+	BaseDelay   int `yaml:"base_delay"`
+	MaxDelay    int `yaml:"max_delay"`
 }
 
 // Rabbit ...
@@ -33,7 +54,44 @@ type Application struct {
 	Port             int    `yaml:"port"`
 	ElasticSearchURL string `yaml:"elasticsearch_url"`
 	GracefulTimeout  int    `yaml:"graceful_timeout"`
-	APIKey           string `yaml:"api_key"`
+	SearchTimeout    int    `yaml:"search_timeout"`
+	WriteTimeout     int    `yaml:"write_timeout"`
+	APIKeysFile      string `yaml:"api_keys_file"`
+	// PriceRanges are the ascending bounds of the price facet buckets
+	PriceRanges []float64 `yaml:"price_ranges"`
+	// PopularityHalfLife is in hours, PopularityFlushInterval in seconds
+	// and PopularityDedupWindow in minutes
+	PopularityHalfLife      int    `yaml:"popularity_half_life"`
+	PopularityFlushInterval int    `yaml:"popularity_flush_interval"`
+	PopularityMaxPending    int    `yaml:"popularity_max_pending"`
+	PopularityDedupWindow   int    `yaml:"popularity_dedup_window"`
+	RankingFile             string `yaml:"ranking_file"`
+	// AnalysisDir is the analysis directory shared with elasticsearch
+	AnalysisDir string `yaml:"analysis_dir"`
+}
+
+// APIKey defines a named api key and the scopes it grants, a zero
+// ExpiresAt never expires. Several keys may share a name so that a
+// new key can be rolled out before the old one is retired. KeySHA256,
+// the hex sha256 digest of the key, keeps the key itself out of the file.
+type APIKey struct {
+	Name      string    `json:"name"`
+	Key       string    `json:"key"`
+	KeySHA256 string    `json:"key_sha256"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RankFeature defines how much a feature of the ranking field boosts the
+// relevance of a product. Function is one of saturation (the default), log
+// or sigmoid, Pivot, ScalingFactor and Exponent are its parameters.
+type RankFeature struct {
+	Name          string  `json:"name"`
+	Weight        float64 `json:"weight"`
+	Function      string  `json:"function"`
+	Pivot         float64 `json:"pivot"`
+	ScalingFactor float64 `json:"scaling_factor"`
+	Exponent      float64 `json:"exponent"`
 }
 
 // AMQP defines amqp config
@@ -67,18 +125,61 @@ func loadApp() error {
 	}
 
 	viper.AutomaticEnv()
+	viper.SetDefault("SEARCH_TIME_OUT", 5)
+	viper.SetDefault("WRITE_TIME_OUT", 30)
+	viper.SetDefault("PRICE_RANGES", "0,500,1000,5000,10000,50000")
+	viper.SetDefault("POPULARITY_HALF_LIFE", 168)
+	viper.SetDefault("POPULARITY_FLUSH_INTERVAL", 10)
+	viper.SetDefault("POPULARITY_MAX_PENDING", 1000)
+	viper.SetDefault("ES_ANALYSIS_DIR", "./analysis")
+
+	prcRngs, err := parsePriceRanges(viper.GetString("PRICE_RANGES"))
+	if err != nil {
+		fmt.Println("ignoring price ranges:", err)
+	}
 
 	appConfig = &Application{
 		Host:             viper.GetString("HOST"),
 		GracefulTimeout:  viper.GetInt("GRACEFUL_TIME_OUT"),
+		SearchTimeout:    viper.GetInt("SEARCH_TIME_OUT"),
+		WriteTimeout:     viper.GetInt("WRITE_TIME_OUT"),
 		Port:             viper.GetInt("PORT"),
 		ElasticSearchURL: viper.GetString("ELASTICSEARCH_URL"),
-		APIKey:           viper.GetString("X_API_KEY"),
+		APIKeysFile:      viper.GetString("API_KEYS_FILE"),
+		PriceRanges:      prcRngs,
+
+		PopularityHalfLife:      viper.GetInt("POPULARITY_HALF_LIFE"),
+		PopularityFlushInterval: viper.GetInt("POPULARITY_FLUSH_INTERVAL"),
+		PopularityMaxPending:    viper.GetInt("POPULARITY_MAX_PENDING"),
+		PopularityDedupWindow:   viper.GetInt("POPULARITY_DEDUP_WINDOW"),
+		RankingFile:             viper.GetString("RANKING_FILE"),
+		AnalysisDir:             viper.GetString("ES_ANALYSIS_DIR"),
 	}
 
 	return nil
 }
 
+// parsePriceRanges parses comma separated ascending bounds, i.e. 0,500,1000
+func parsePriceRanges(s string) ([]float64, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var bounds []float64
+	for _, b := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid price range bound %q", b)
+		}
+		if len(bounds) > 0 && v <= bounds[len(bounds)-1] {
+			return nil, fmt.Errorf("price range bounds must be ascending, got %v after %v", v, bounds[len(bounds)-1])
+		}
+		bounds = append(bounds, v)
+	}
+
+	return bounds, nil
+}
+
 // loadTaskConfig loads task config
 func loadTaskConfig() {
 	err := godotenv.Load()
@@ -117,17 +218,99 @@ func loadWorker() {
 	}
 
 	viper.AutomaticEnv()
+	viper.SetDefault("WORKER_TASK_TIMEOUT", 60)
+	viper.SetDefault("WORKER_STATS_INTERVAL", 60)
+	viper.SetDefault("WORKER_BATCH_SIZE", 500)
+	viper.SetDefault("WORKER_BATCH_WINDOW", 500)
+	viper.SetDefault("WORKER_RETRY_MAX_ATTEMPTS", 5)
+	viper.SetDefault("WORKER_RETRY_BASE_DELAY", 5)
+	viper.SetDefault("WORKER_RETRY_MAX_DELAY", 300)
 
 	workerConfig = &Worker{
 		Name:             viper.GetString("WORKER_NAME"),
 		ConcurrencyCount: viper.GetInt("WORKER_CONCURRENCY_LIMIT"),
+		TaskTimeout:      viper.GetInt("WORKER_TASK_TIMEOUT"),
+		StatsInterval:    viper.GetInt("WORKER_STATS_INTERVAL"),
+		BatchSize:        viper.GetInt("WORKER_BATCH_SIZE"),
+		BatchWindow:      viper.GetInt("WORKER_BATCH_WINDOW"),
 		Rabbit: Rabbit{
 			URL:                 viper.GetString("RABBIT_URL"),
 			QueueName:           viper.GetString("QUEUE_NAME"),
 			CatalogExchangeName: viper.GetString("CATALOG_EXCHANGE_NAME"),
 			CatalogExchangeType: viper.GetString("CATALOG_EXCHANGE_TYPE"),
 		},
+		Retry: Retry{
+			MaxAttempts: viper.GetInt("WORKER_RETRY_MAX_ATTEMPTS"),
+			BaseDelay:   viper.GetInt("WORKER_RETRY_BASE_DELAY"),
+			MaxDelay:    viper.GetInt("WORKER_RETRY_MAX_DELAY"),
+		},
+	}
+}
+
+// LoadAPIKeys reads the api keys from the json file at path, it is read
+// on every call so that keys can be rotated while the server is running
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	if path == "" {
+		return nil, errors.New("api keys file is not configured")
 	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("invalid api keys file %s: %w", path, err)
+	}
+
+	for i, k := range keys {
+		if k.Name == "" || (k.Key == "") == (k.KeySHA256 == "") {
+			return nil, fmt.Errorf("invalid api keys file %s: key #%d needs a name and either a key or a key_sha256", path, i)
+		}
+	}
+
+	return keys, nil
+}
+
+// LoadRankFeatures reads the rank features from the json file at path, it is
+// read on every call so that weights can be tuned while the server is running.
+// No path means no boosting.
+func LoadRankFeatures(path string) ([]RankFeature, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fts []RankFeature
+	if err := json.Unmarshal(b, &fts); err != nil {
+		return nil, fmt.Errorf("invalid ranking file %s: %w", path, err)
+	}
+
+	for i, f := range fts {
+		if f.Name == "" || f.Weight <= 0 {
+			return nil, fmt.Errorf("invalid ranking file %s: feature #%d needs a name and a positive weight", path, i)
+		}
+		switch f.Function {
+		case "", "saturation":
+		case "log":
+			if f.ScalingFactor <= 0 {
+				return nil, fmt.Errorf("invalid ranking file %s: log feature %s needs a scaling_factor", path, f.Name)
+			}
+		case "sigmoid":
+			if f.Pivot <= 0 || f.Exponent <= 0 {
+				return nil, fmt.Errorf("invalid ranking file %s: sigmoid feature %s needs a pivot and an exponent", path, f.Name)
+			}
+		default:
+			return nil, fmt.Errorf("invalid ranking file %s: feature %s has unknown function %q", path, f.Name, f.Function)
+		}
+	}
+
+	return fts, nil
 }
 
 // GetApp returns application config
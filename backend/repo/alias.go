@@ -0,0 +1,495 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// Catalog indices are versioned, documents live in physical indices named
+// <alias>_v<version>. Reads go through the alias, writes through
+// <alias>_write, so a new version can be filled and switched to without
+// clients noticing.
+
+// versionedIndex names version v of the physical index behind alias
+func versionedIndex(alias string, v int) string {
+	return fmt.Sprintf("%s_v%d", alias, v)
+}
+
+// writeAlias names the alias writes to the alias go through
+func writeAlias(alias string) string {
+	return alias + "_write"
+}
+
+// indexVersion returns the version of the physical index behind alias
+func indexVersion(alias string, index string) (int, bool) {
+	v, err := strconv.Atoi(strings.TrimPrefix(index, alias+"_v"))
+	if err != nil || !strings.HasPrefix(index, alias+"_v") {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// aliasIndices returns the indices alias points to, none when alias doesn't exist
+func aliasIndices(ctx context.Context, es *elasticsearch.Client, alias string) ([]string, error) {
+	res, err := es.Indices.GetAlias(
+		es.Indices.GetAlias.WithName(alias),
+		es.Indices.GetAlias.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error getting alias, error: ", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, decodeErrorResponse("aliasIndices", res)
+	}
+
+	var r map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, newMalformedResponseError("%s", err)
+	}
+
+	idxs := make([]string, 0, len(r))
+	for idx := range r {
+		idxs = append(idxs, idx)
+	}
+	sort.Strings(idxs)
+
+	return idxs, nil
+}
+
+// indexVersions returns the versions of the physical indices behind alias, ascending
+func indexVersions(ctx context.Context, es *elasticsearch.Client, alias string) ([]int, error) {
+	res, err := es.Indices.Get(
+		[]string{alias + "_v*"},
+		es.Indices.Get.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error getting indices, error: ", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, decodeErrorResponse("indexVersions", res)
+	}
+
+	var r map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, newMalformedResponseError("%s", err)
+	}
+
+	vs := []int{}
+	for idx := range r {
+		if v, ok := indexVersion(alias, idx); ok {
+			vs = append(vs, v)
+		}
+	}
+	sort.Ints(vs)
+
+	return vs, nil
+}
+
+// indexExists reports whether name is an index or an alias
+func indexExists(ctx context.Context, es *elasticsearch.Client, name string) (bool, error) {
+	res, err := es.Indices.Exists([]string{name}, es.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		log.Println("error checking index, error: ", err)
+		return false, err
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode == 200, nil
+}
+
+// updateAliases applies the alias actions atomically
+func updateAliases(ctx context.Context, es *elasticsearch.Client, actions ...map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+
+	res, err := es.Indices.UpdateAliases(bytes.NewReader(body), es.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		log.Println("error updating aliases, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("updateAliases", res)
+	}
+
+	return nil
+}
+
+func addAlias(index string, alias string) map[string]interface{} {
+	return map[string]interface{}{
+		"add": map[string]interface{}{"index": index, "alias": alias},
+	}
+}
+
+func removeAlias(index string, alias string) map[string]interface{} {
+	return map[string]interface{}{
+		"remove": map[string]interface{}{"index": index, "alias": alias},
+	}
+}
+
+// countDocs returns the number of documents of index
+func countDocs(ctx context.Context, es *elasticsearch.Client, index string) (int64, error) {
+	res, err := es.Count(es.Count.WithIndex(index), es.Count.WithContext(ctx))
+	if err != nil {
+		log.Println("error counting documents, error: ", err)
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, decodeErrorResponse("countDocs", res)
+	}
+
+	var r struct {
+		Count *int64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil || r.Count == nil {
+		return 0, newMalformedResponseError("missing count")
+	}
+
+	return *r.Count, nil
+}
+
+// reindexCleanupTimeout bounds lifting the write block and deleting the new
+// index once reindexing is over
+const reindexCleanupTimeout = time.Minute
+
+// pruneBatchSize is how many document ids pruneDocs checks at once
+const pruneBatchSize = 1000
+
+// reindexDocs copies the documents of src matching query, every document
+// when query is nil, into dst and refreshes dst. Documents already in dst
+// are overwritten.
+func reindexDocs(ctx context.Context, es *elasticsearch.Client, src string, dst string, query map[string]interface{}) error {
+	source := map[string]interface{}{"index": src}
+	if query != nil {
+		source["query"] = query
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"source": source,
+		"dest":   map[string]interface{}{"index": dst},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := es.Reindex(
+		bytes.NewReader(body),
+		es.Reindex.WithWaitForCompletion(true),
+		es.Reindex.WithRefresh(true),
+		es.Reindex.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error reindexing, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("reindexDocs", res)
+	}
+
+	var r struct {
+		Total    int64             `json:"total"`
+		Created  int64             `json:"created"`
+		Updated  int64             `json:"updated"`
+		Failures []json.RawMessage `json:"failures"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return newMalformedResponseError("%s", err)
+	}
+	if len(r.Failures) > 0 {
+		return fmt.Errorf("reindexing %s into %s: %d documents failed, first: %s", src, dst, len(r.Failures), r.Failures[0])
+	}
+	log.Printf("reindexed %s into %s: %d documents, %d created, %d updated\n", src, dst, r.Total, r.Created, r.Updated)
+
+	return nil
+}
+
+// localCheckpoint returns the lowest local checkpoint of the primary shards
+// of index, every write with a sequence number up to it was processed by
+// every primary. It is -1 when nothing was written yet.
+func localCheckpoint(ctx context.Context, es *elasticsearch.Client, index string) (int64, error) {
+	res, err := es.Indices.Stats(
+		es.Indices.Stats.WithIndex(index),
+		es.Indices.Stats.WithLevel("shards"),
+		es.Indices.Stats.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error getting index stats, error: ", err)
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return 0, decodeErrorResponse("localCheckpoint", res)
+	}
+
+	var r struct {
+		Indices map[string]struct {
+			Shards map[string][]struct {
+				Routing struct {
+					Primary bool `json:"primary"`
+				} `json:"routing"`
+				SeqNo struct {
+					LocalCheckpoint int64 `json:"local_checkpoint"`
+				} `json:"seq_no"`
+			} `json:"shards"`
+		} `json:"indices"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return 0, newMalformedResponseError("%s", err)
+	}
+
+	checkpoint, found := int64(-1), false
+	for _, idx := range r.Indices {
+		for _, copies := range idx.Shards {
+			for _, c := range copies {
+				if c.Routing.Primary && (!found || c.SeqNo.LocalCheckpoint < checkpoint) {
+					checkpoint, found = c.SeqNo.LocalCheckpoint, true
+				}
+			}
+		}
+	}
+
+	return checkpoint, nil
+}
+
+// refreshIndex makes every document written to index so far searchable
+func refreshIndex(ctx context.Context, es *elasticsearch.Client, index string) error {
+	res, err := es.Indices.Refresh(
+		es.Indices.Refresh.WithIndex(index),
+		es.Indices.Refresh.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error refreshing index, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("refreshIndex", res)
+	}
+
+	return nil
+}
+
+// setWriteBlock blocks or unblocks writes to index, reads go on either way
+func setWriteBlock(ctx context.Context, es *elasticsearch.Client, index string, blocked bool) error {
+	var block interface{}
+	if blocked {
+		block = true
+	}
+	body, err := json.Marshal(map[string]interface{}{"index.blocks.write": block})
+	if err != nil {
+		return err
+	}
+
+	res, err := es.Indices.PutSettings(
+		bytes.NewReader(body),
+		es.Indices.PutSettings.WithIndex(index),
+		es.Indices.PutSettings.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error setting write block, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("setWriteBlock", res)
+	}
+
+	return nil
+}
+
+// deleteIndex deletes index, an index that doesn't exist is no error
+func deleteIndex(ctx context.Context, es *elasticsearch.Client, index string) error {
+	res, err := es.Indices.Delete([]string{index}, es.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		log.Println("error deleting index, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != 404 {
+		return decodeErrorResponse("deleteIndex", res)
+	}
+
+	return nil
+}
+
+// pruneDocs deletes the documents of dst that src doesn't have, src must
+// not be written to meanwhile
+func pruneDocs(ctx context.Context, es *elasticsearch.Client, src string, dst string) error {
+	pruned := 0
+	var after []interface{}
+	for {
+		query := map[string]interface{}{
+			"size":    pruneBatchSize,
+			"_source": false,
+			"sort":    []map[string]interface{}{{"_id": "asc"}},
+		}
+		if after != nil {
+			query["search_after"] = after
+		}
+		r, err := searchIndex(ctx, es, dst, query)
+		if err != nil {
+			return err
+		}
+		if len(r.Hits.Hits) == 0 {
+			break
+		}
+
+		ids := make([]string, 0, len(r.Hits.Hits))
+		for _, h := range r.Hits.Hits {
+			ids = append(ids, h.ID)
+		}
+		missing, err := missingDocs(ctx, es, src, ids)
+		if err != nil {
+			return err
+		}
+		if err := deleteDocs(ctx, es, dst, missing); err != nil {
+			return err
+		}
+		pruned += len(missing)
+
+		after = []interface{}{ids[len(ids)-1]}
+	}
+	log.Printf("pruned %d documents deleted from %s during the copy out of %s\n", pruned, src, dst)
+
+	return refreshIndex(ctx, es, dst)
+}
+
+// searchIndex runs query against index
+func searchIndex(ctx context.Context, es *elasticsearch.Client, index string, query map[string]interface{}) (*esSearchResponse, error) {
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := es.Search(
+		es.Search.WithIndex(index),
+		es.Search.WithBody(bytes.NewReader(body)),
+		es.Search.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error searching index, error: ", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, decodeErrorResponse("searchIndex", res)
+	}
+
+	var r esSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil || r.Hits == nil {
+		return nil, newMalformedResponseError("missing hits")
+	}
+
+	return &r, nil
+}
+
+// missingDocs returns the ids index has no document for
+func missingDocs(ctx context.Context, es *elasticsearch.Client, index string, ids []string) ([]string, error) {
+	body, err := json.Marshal(map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := es.Mget(
+		bytes.NewReader(body),
+		es.Mget.WithIndex(index),
+		es.Mget.WithSource("false"),
+		es.Mget.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error getting documents, error: ", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, decodeErrorResponse("missingDocs", res)
+	}
+
+	var r struct {
+		Docs []struct {
+			ID    string `json:"_id"`
+			Found bool   `json:"found"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, newMalformedResponseError("%s", err)
+	}
+
+	missing := []string{}
+	for _, d := range r.Docs {
+		if !d.Found {
+			missing = append(missing, d.ID)
+		}
+	}
+
+	return missing, nil
+}
+
+// deleteDocs deletes the documents ids of index
+func deleteDocs(ctx context.Context, es *elasticsearch.Client, index string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, id := range ids {
+		meta, err := json.Marshal(map[string]interface{}{"delete": map[string]interface{}{"_id": id}})
+		if err != nil {
+			return err
+		}
+		buf.Write(meta)
+		buf.WriteString("\n")
+	}
+
+	res, err := es.Bulk(bytes.NewReader(buf.Bytes()), es.Bulk.WithIndex(index), es.Bulk.WithContext(ctx))
+	if err != nil {
+		log.Println("error deleting documents, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("deleteDocs", res)
+	}
+
+	bres, err := decodeBulkResponse(res.Body)
+	if err != nil {
+		return err
+	}
+	if bres.HasFailures() {
+		return fmt.Errorf("pruning %s: %d documents failed, first: %s", index, len(bres.Failed), bres.Failed[0].Reason)
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/elastic/go-elasticsearch/v7"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alias", func() {
+	It("parses versions of the indices behind an alias only", func() {
+		v, ok := indexVersion("products", versionedIndex("products", 12))
+		Expect(ok).To(BeTrue())
+		Expect(v).To(Equal(12))
+
+		_, ok = indexVersion("products", "products_write")
+		Expect(ok).To(BeFalse())
+		_, ok = indexVersion("shops", "products_v1")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+// routedTransport answers every request by its method and path, records
+// them in order and answers unknown ones with 404
+type routedTransport struct {
+	routes   map[string]fakeRoute
+	requests []string
+	bodies   map[string]string
+	// onRequest, if any, is called before a request is answered
+	onRequest func(key string)
+}
+
+type fakeRoute struct {
+	status   int
+	response string
+}
+
+func (t *routedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + req.URL.Path
+	t.requests = append(t.requests, key)
+	if req.Body != nil {
+		b, _ := ioutil.ReadAll(req.Body)
+		t.bodies[key] += string(b)
+	}
+	if t.onRequest != nil {
+		t.onRequest(key)
+	}
+
+	rt, ok := t.routes[key]
+	if !ok {
+		rt = fakeRoute{status: http.StatusNotFound, response: `{}`}
+	}
+
+	return &http.Response{
+		StatusCode: rt.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(rt.response)),
+	}, nil
+}
+
+var _ = Describe("Reindex", func() {
+	var (
+		trnsprt *routedTransport
+		ir      *indexRepo[search.Brand]
+	)
+
+	ok := func(response string) fakeRoute {
+		return fakeRoute{status: http.StatusOK, response: response}
+	}
+
+	BeforeEach(func() {
+		trnsprt = &routedTransport{bodies: map[string]string{}, routes: map[string]fakeRoute{
+			"GET /_alias/brands_write": ok(`{"brands_v1": {"aliases": {"brands_write": {}}}}`),
+			"GET /_alias/brands":       ok(`{"brands_v1": {"aliases": {"brands": {}}}}`),
+			"GET /brands_v1/_stats":    ok(`{"indices": {"brands_v1": {"shards": {"0": [{"routing": {"primary": true}, "seq_no": {"local_checkpoint": 41}}, {"routing": {"primary": false}, "seq_no": {"local_checkpoint": 7}}]}}}}`),
+			"POST /brands_v1/_refresh": ok(`{}`),
+			"GET /brands_v*":           ok(`{"brands_v1": {}}`),
+			"PUT /brands_v2":           ok(`{"acknowledged": true}`),
+			"POST /_reindex":           ok(`{"total": 3, "created": 3, "failures": []}`),
+			"PUT /brands_v1/_settings": ok(`{"acknowledged": true}`),
+			"POST /brands_v1/_count":   ok(`{"count": 3}`),
+			"POST /brands_v2/_count":   ok(`{"count": 3}`),
+			"POST /_aliases":           ok(`{"acknowledged": true}`),
+			"DELETE /brands_v2":        ok(`{"acknowledged": true}`),
+			"GET /brands_v2/_search":   ok(`{"hits": {"hits": []}}`),
+			"POST /brands_v2/_refresh": ok(`{}`),
+		}}
+		client, err := elasticsearch.NewClient(elasticsearch.Config{Transport: trnsprt})
+		Expect(err).ToNot(HaveOccurred())
+		ir = newIndexRepo(client, "brands", indexSpec[search.Brand]{name: "brandRepo", mapping: BrandMapping})
+	})
+
+	It("catches up on the writes since the copy and switches reads and writes at once", func() {
+		Expect(ir.Reindex(context.Background())).To(Succeed())
+
+		Expect(trnsprt.requests).To(Equal([]string{
+			"GET /_alias/brands_write",
+			"GET /brands_v1/_stats",
+			"POST /brands_v1/_refresh",
+			"GET /brands_v*",
+			"PUT /brands_v2",
+			"POST /_reindex",
+			"PUT /brands_v1/_settings",
+			"POST /brands_v1/_refresh",
+			"POST /_reindex",
+			"POST /brands_v1/_count",
+			"POST /brands_v2/_count",
+			"GET /_alias/brands",
+			"POST /_aliases",
+			"PUT /brands_v1/_settings",
+		}))
+		Expect(trnsprt.bodies["POST /_reindex"]).To(ContainSubstring(`"query":{"range":{"_seq_no":{"gt":41}}}`))
+		Expect(trnsprt.bodies["PUT /brands_v1/_settings"]).To(Equal(`{"index.blocks.write":true}{"index.blocks.write":null}`))
+		Expect(trnsprt.bodies["POST /_aliases"]).To(Equal(`{"actions":[` +
+			`{"add":{"alias":"brands","index":"brands_v2"}},` +
+			`{"add":{"alias":"brands_write","index":"brands_v2"}},` +
+			`{"remove":{"alias":"brands","index":"brands_v1"}},` +
+			`{"remove":{"alias":"brands_write","index":"brands_v1"}}]}`))
+	})
+
+	It("leaves the aliases alone, lifts the block and drops the new index on failure", func() {
+		trnsprt.routes["POST /brands_v2/_count"] = ok(`{"count": 2}`)
+
+		Expect(ir.Reindex(context.Background())).NotTo(Succeed())
+		Expect(trnsprt.requests).NotTo(ContainElement("POST /_aliases"))
+		Expect(trnsprt.bodies["PUT /brands_v1/_settings"]).To(HaveSuffix(`{"index.blocks.write":null}`))
+		Expect(trnsprt.requests[len(trnsprt.requests)-1]).To(Equal("DELETE /brands_v2"))
+	})
+
+	It("prunes the documents deleted during the copy", func() {
+		trnsprt.routes["POST /brands_v2/_count"] = ok(`{"count": 4}`)
+		trnsprt.routes["GET /brands_v2/_search"] = ok(`{"hits": {"hits": [{"_id": "1"}, {"_id": "9"}]}}`)
+		trnsprt.routes["GET /brands_v1/_mget"] = ok(`{"docs": [{"_id": "1", "found": true}, {"_id": "9", "found": false}]}`)
+		trnsprt.routes["POST /brands_v2/_bulk"] = ok(`{"errors": false, "items": [{"delete": {"_id": "9", "result": "deleted", "status": 200}}]}`)
+
+		// the second page of ids is empty, the recount then matches
+		searched := 0
+		trnsprt.onRequest = func(key string) {
+			if key == "GET /brands_v2/_search" {
+				searched++
+				if searched > 1 {
+					trnsprt.routes[key] = ok(`{"hits": {"hits": []}}`)
+					trnsprt.routes["POST /brands_v2/_count"] = ok(`{"count": 3}`)
+				}
+			}
+		}
+
+		Expect(ir.Reindex(context.Background())).To(Succeed())
+		Expect(trnsprt.bodies["POST /brands_v2/_bulk"]).To(Equal(`{"delete":{"_id":"9"}}` + "\n"))
+		Expect(trnsprt.bodies["GET /brands_v2/_search"]).To(ContainSubstring(`"search_after":["9"]`))
+		Expect(trnsprt.requests).To(ContainElement("POST /_aliases"))
+	})
+})
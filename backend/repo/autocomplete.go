@@ -0,0 +1,157 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// msearchGroup is one search of a multi search, decode reads its response
+type msearchGroup struct {
+	index  string
+	query  map[string]interface{}
+	decode func(r *esSearchResponse) error
+}
+
+// suggestGroup returns the search as you type of req for a group of
+// autocomplete suggestions, the highlighted hits are decoded into dst
+func (ir *indexRepo[T]) suggestGroup(req search.SuggestReq, size int, dst *[]*search.Highlighted[T]) msearchGroup {
+	query := map[string]interface{}{
+		"size": size,
+		"query": map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  req.Term,
+				"type":   "bool_prefix",
+				"fields": ir.spec.searchFields,
+			},
+		},
+	}
+	applyHighlight(query, ir.spec.highlightFields)
+	if !req.IncludeHidden {
+		applyVisibility(query, ir.spec.visibility)
+	}
+
+	return msearchGroup{
+		index: ir.index,
+		query: query,
+		decode: func(r *esSearchResponse) error {
+			docs, err := ir.hits(ir.op("Suggest"), r.Hits.Hits)
+			if err != nil {
+				return err
+			}
+			*dst = docs
+
+			return nil
+		},
+	}
+}
+
+type esMsearchResponse struct {
+	Responses []struct {
+		esSearchResponse
+		Error  json.RawMessage `json:"error"`
+		Status int             `json:"status"`
+	} `json:"responses"`
+}
+
+type suggestRepo struct {
+	client *elasticsearch.Client
+	prd    ProductRepo
+	brnd   BrandRepo
+	shp    ShopRepo
+	ctg    CategoryRepo
+}
+
+// NewSuggestRepo returns a repo suggesting from the indices of the repos
+func NewSuggestRepo(client *elasticsearch.Client, prd ProductRepo, brnd BrandRepo, shp ShopRepo, ctg CategoryRepo) search.SuggestRepo {
+	return &suggestRepo{
+		client: client,
+		prd:    prd,
+		brnd:   brnd,
+		shp:    shp,
+		ctg:    ctg,
+	}
+}
+
+// Suggest runs the search as you type of every group asked for in a single
+// multi search. A group that fails is logged and left empty, the others are
+// still suggested.
+func (sr *suggestRepo) Suggest(ctx context.Context, req search.SuggestReq) (*search.SuggestRes, error) {
+	res := &search.SuggestRes{
+		Brands:     []*search.Highlighted[search.Brand]{},
+		Shops:      []*search.Highlighted[search.Shop]{},
+		Categories: []*search.Highlighted[search.Category]{},
+		Products:   []*search.Highlighted[search.Product]{},
+	}
+
+	groups := []msearchGroup{}
+	for _, g := range search.SuggestGroups() {
+		size := req.Limits[g]
+		if size <= 0 {
+			continue
+		}
+
+		switch g {
+		case search.SuggestBrands:
+			groups = append(groups, sr.brnd.suggestGroup(req, size, &res.Brands))
+		case search.SuggestShops:
+			groups = append(groups, sr.shp.suggestGroup(req, size, &res.Shops))
+		case search.SuggestCategories:
+			groups = append(groups, sr.ctg.suggestGroup(req, size, &res.Categories))
+		case search.SuggestProducts:
+			groups = append(groups, sr.prd.suggestGroup(req, size, &res.Products))
+		}
+	}
+	if len(groups) == 0 {
+		return res, nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, g := range groups {
+		if err := enc.Encode(map[string]interface{}{"index": g.index}); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(g.query); err != nil {
+			log.Printf("suggestRepo.Suggest: Error encoding query: %s\n", err)
+			return nil, err
+		}
+	}
+
+	r, err := sr.client.Msearch(&buf, sr.client.Msearch.WithContext(ctx))
+	if err != nil {
+		log.Printf("suggestRepo.Suggest: Error getting response: %s\n", err)
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	if r.IsError() {
+		return nil, decodeErrorResponse("suggestRepo.Suggest", r)
+	}
+
+	var mr esMsearchResponse
+	if err := json.NewDecoder(r.Body).Decode(&mr); err != nil {
+		log.Printf("suggestRepo.Suggest: Error parsing the response body: %s\n", err)
+		return nil, newMalformedResponseError("%s", err)
+	}
+	if len(mr.Responses) != len(groups) {
+		return nil, newMalformedResponseError("%d responses to %d searches", len(mr.Responses), len(groups))
+	}
+
+	for i, g := range groups {
+		gr := mr.Responses[i]
+		if len(gr.Error) > 0 || gr.Hits == nil {
+			log.Printf("suggestRepo.Suggest: [%d] Error searching %s: %s\n", gr.Status, g.index, gr.Error)
+			continue
+		}
+		if err := g.decode(&gr.esSearchResponse); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
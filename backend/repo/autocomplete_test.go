@@ -0,0 +1,55 @@
+package repo
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SuggestRepo", func() {
+	var (
+		trnsprt *fakeTransport
+		sr      search.SuggestRepo
+	)
+
+	BeforeEach(func() {
+		trnsprt = &fakeTransport{status: http.StatusOK}
+		es := newFakeClient(trnsprt)
+		sr = NewSuggestRepo(es,
+			NewProductRepo(es, RepoNameProduct),
+			NewBrandRepo(es, RepoNameBrand),
+			NewShopRepo(es, RepoNameShop),
+			NewCategoryRepo(es, RepoNameCategory),
+		)
+	})
+
+	It("suggests the groups asked for in one multi search", func() {
+		trnsprt.response = `{"responses": [
+			{"status": 200, "hits": {"total": {"value": 1}, "hits": [{"_id": "7", "_source": {"id": 7, "name": "walton"}, "highlight": {"name.search_as_type": ["<em>wal</em>ton"]}}]}},
+			{"status": 404, "error": {"type": "index_not_found_exception"}}
+		]}`
+
+		res, err := sr.Suggest(context.Background(), search.SuggestReq{
+			Term:   "wal",
+			Limits: map[search.SuggestGroup]int{search.SuggestBrands: 3, search.SuggestProducts: 5},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(trnsprt.path).To(Equal("/_msearch"))
+		lines := strings.Split(strings.TrimSpace(trnsprt.body), "\n")
+		Expect(lines).To(HaveLen(4))
+		Expect(lines[0]).To(Equal(`{"index":"brands"}`))
+		Expect(lines[1]).To(ContainSubstring(`"size":3`))
+		Expect(lines[2]).To(Equal(`{"index":"products"}`))
+
+		Expect(res.Brands).To(HaveLen(1))
+		Expect(res.Brands[0].Doc.Name).To(Equal("walton"))
+		Expect(res.Brands[0].Highlight).To(Equal(map[string][]string{"name": {"<em>wal</em>ton"}}))
+		Expect(res.Products).To(BeEmpty())
+		Expect(res.Shops).To(BeEmpty())
+	})
+})
@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// categoryLevelsScript derives the category levels of a product from its
+// category path, like categoryLevels does when the product is written
+const categoryLevelsScript = `def lvls = new HashMap();
+def path = ctx._source.category_path;
+if (path instanceof List) {
+	for (int i = 0; i < path.size(); i++) {
+		lvls['lvl' + i] = String.join(params.separator, path.subList(0, i + 1));
+	}
+}
+ctx._source.category_levels = lvls;`
+
+// effectivePriceScript derives the effective price of a product from its
+// prices, like effectivePrice does when the product is written
+const effectivePriceScript = `def p = ctx._source.price;
+def d = ctx._source.discounted_price;
+if (d != null && d > 0) {
+	ctx._source.effective_price = d;
+} else {
+	ctx._source.effective_price = p != null ? p : 0;
+}`
+
+// discountPctScript derives the discount of a product in percent from its
+// prices, like discountPct does when the product is written. Prices may be
+// integers in the source, 100.0 keeps the division a floating one.
+const discountPctScript = `def p = ctx._source.price;
+def d = ctx._source.discounted_price;
+if (p == null || d == null || p <= 0 || d <= 0 || d >= p) {
+	ctx._source.discount_pct = 0;
+} else {
+	ctx._source.discount_pct = (p - d) * 100.0 / p;
+}`
+
+// popularityLog2Script converts the linear popularity of a product, which
+// is no longer written, into the log2 popularity
+const popularityLog2Script = `def p = ctx._source.pop_score;
+if (p == null || p <= 0) {
+	ctx.op = 'noop';
+} else {
+	ctx._source.pop_score_log2 = Math.log(p) / Math.log(2);
+}`
+
+// backfillProducts sets field on every product missing it by script, the
+// products written since the field exists already carry it
+func backfillProducts(field string, script string, params map[string]interface{}) func(ctx context.Context, es *elasticsearch.Client) error {
+	return func(ctx context.Context, es *elasticsearch.Client) error {
+		return NewProductRepo(es, RepoNameProduct).(*productRepo).backfill(ctx, field, script, params)
+	}
+}
+
+// backfill runs script on the products missing field and waits for it to
+// complete
+func (pr *productRepo) backfill(ctx context.Context, field string, script string, params map[string]interface{}) error {
+	scrpt := map[string]interface{}{
+		"source": script,
+		"lang":   "painless",
+	}
+	if len(params) > 0 {
+		scrpt["params"] = params
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must_not": []map[string]interface{}{
+					{"exists": map[string]interface{}{"field": field}},
+				},
+			},
+		},
+		"script": scrpt,
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := pr.client.UpdateByQuery(
+		[]string{pr.writeIndex},
+		pr.client.UpdateByQuery.WithBody(bytes.NewReader(body)),
+		pr.client.UpdateByQuery.WithConflicts("proceed"),
+		pr.client.UpdateByQuery.WithWaitForCompletion(true),
+		pr.client.UpdateByQuery.WithContext(ctx),
+	)
+	if err != nil {
+		log.Printf("productRepo.backfill: Error getting response: %s\n", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("productRepo.backfill", res)
+	}
+
+	var r struct {
+		Updated int64 `json:"updated"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return newMalformedResponseError("%s", err)
+	}
+	log.Printf("productRepo.backfill: backfilled %s of %d products\n", field, r.Updated)
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// bulk item results elasticsearch reports for documents it didn't change
+const (
+	bulkResultNoop     = "noop"
+	bulkResultNotFound = "not_found"
+)
+
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+type bulkItem struct {
+	ID     string         `json:"_id"`
+	Result string         `json:"result"`
+	Status int            `json:"status"`
+	Error  *bulkItemError `json:"error"`
+}
+
+type bulkResponse struct {
+	Took   int64                 `json:"took"`
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+// decodeBulkResponse decodes a successful _bulk response into a BulkResult,
+// every item is keyed by its action (index, update, delete)
+func decodeBulkResponse(body io.Reader) (*search.BulkResult, error) {
+	var r bulkResponse
+	if err := json.NewDecoder(body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	res := &search.BulkResult{
+		Succeeded: []string{},
+		Skipped:   []string{},
+		Failed:    []search.BulkItemFailure{},
+	}
+	for _, item := range r.Items {
+		for _, it := range item {
+			switch {
+			case it.Error != nil:
+				res.Failed = append(res.Failed, search.BulkItemFailure{
+					ID:     it.ID,
+					Status: it.Status,
+					Type:   it.Error.Type,
+					Reason: it.Error.Reason,
+				})
+			case it.Result == bulkResultNoop || it.Result == bulkResultNotFound:
+				res.Skipped = append(res.Skipped, it.ID)
+			default:
+				res.Succeeded = append(res.Succeeded, it.ID)
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,41 @@
+package repo
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bulk", func() {
+	Context("decoding bulk response: ", func() {
+		It("splits items into succeeded, skipped and failed", func() {
+			body := `{
+				"took": 3,
+				"errors": true,
+				"items": [
+					{"index": {"_id": "1", "result": "created", "status": 201}},
+					{"update": {"_id": "2", "result": "noop", "status": 200}},
+					{"delete": {"_id": "3", "result": "not_found", "status": 404}},
+					{"update": {"_id": "4", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse field [price]"}}}
+				]
+			}`
+
+			res, err := decodeBulkResponse(strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(res.Succeeded).To(Equal([]string{"1"}))
+			Expect(res.Skipped).To(Equal([]string{"2", "3"}))
+			Expect(res.Failed).To(HaveLen(1))
+			Expect(res.Failed[0].ID).To(Equal("4"))
+			Expect(res.Failed[0].Status).To(Equal(400))
+			Expect(res.Failed[0].Type).To(Equal("mapper_parsing_exception"))
+			Expect(res.Failed[0].Reason).To(Equal("failed to parse field [price]"))
+			Expect(res.HasFailures()).To(BeTrue())
+		})
+
+		It("returns error on malformed response", func() {
+			_, err := decodeBulkResponse(strings.NewReader(`{"items": [`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
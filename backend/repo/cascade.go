@@ -0,0 +1,179 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// cascadeRequestsPerSecond throttles the update by query cascading a change
+// into the products, so a rename of a large shop doesn't starve searches
+const cascadeRequestsPerSecond = 500
+
+// CascadeShop starts rewriting the shop name, slug and approval of every
+// product of the shop, it returns the id of the elasticsearch task doing so.
+// Products are matched by shop id, products written without one by fromSlug,
+// the slug of the shop before the change. Products already carrying a newer
+// version of the shop are left untouched.
+func (pr *productRepo) CascadeShop(ctx context.Context, fromSlug string, shop *search.Shop) (string, error) {
+	return pr.cascade(ctx, "productRepo.CascadeShop", "shop", shop.ID, fromSlug, shop.Version, map[string]interface{}{
+		"shop_name":     shop.ShopName,
+		"shop_slug":     shop.Slug,
+		"shop_approved": shop.Approved(),
+	})
+}
+
+// CascadeBrand starts rewriting the brand name and slug of every product of
+// the brand, like CascadeShop does for shops
+func (pr *productRepo) CascadeBrand(ctx context.Context, fromSlug string, brand *search.Brand) (string, error) {
+	return pr.cascade(ctx, "productRepo.CascadeBrand", "brand", brand.ID, fromSlug, brand.Version, map[string]interface{}{
+		"brand_name": brand.Name,
+		"brand_slug": brand.Slug,
+	})
+}
+
+// cascade starts an update by query setting fields on the products whose
+// <entity>_id is id, or without one whose <entity>_slug is fromSlug,
+// versioned by <entity>_version
+func (pr *productRepo) cascade(ctx context.Context, op string, entity string, id int64, fromSlug string, version int64, fields map[string]interface{}) (string, error) {
+	idField, slugField, versionField := entity+"_id", entity+"_slug", entity+"_version"
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+
+	source := fmt.Sprintf("ctx._source.%s = params.version;", versionField)
+	for _, f := range names {
+		source += fmt.Sprintf(" ctx._source.%s = params.fields.%s;", f, f)
+	}
+	source = fmt.Sprintf("if (ctx._source.%s != null && ctx._source.%s >= params.version) { ctx.op = 'noop' } else { %s }", versionField, versionField, source)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{{
+					"bool": map[string]interface{}{
+						"should": []map[string]interface{}{
+							{"term": map[string]interface{}{idField: id}},
+							{"bool": map[string]interface{}{
+								"filter":   []map[string]interface{}{{"term": map[string]interface{}{slugField: fromSlug}}},
+								"must_not": []map[string]interface{}{{"exists": map[string]interface{}{"field": idField}}},
+							}},
+						},
+						"minimum_should_match": 1,
+					},
+				}},
+				// products already at this version or a newer one are
+				// noops, skipping them spares the script
+				"must_not": []map[string]interface{}{
+					{"range": map[string]interface{}{versionField: map[string]interface{}{"gte": version}}},
+				},
+			},
+		},
+		"script": map[string]interface{}{
+			"source": source,
+			"lang":   "painless",
+			"params": map[string]interface{}{
+				"version": version,
+				"fields":  fields,
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	res, err := pr.client.UpdateByQuery(
+		[]string{pr.writeIndex},
+		pr.client.UpdateByQuery.WithBody(bytes.NewReader(body)),
+		pr.client.UpdateByQuery.WithConflicts("proceed"),
+		pr.client.UpdateByQuery.WithRequestsPerSecond(cascadeRequestsPerSecond),
+		pr.client.UpdateByQuery.WithSlices("auto"),
+		pr.client.UpdateByQuery.WithWaitForCompletion(false),
+		pr.client.UpdateByQuery.WithContext(ctx),
+	)
+	if err != nil {
+		log.Printf("%s: Error getting response: %s\n", op, err)
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", decodeErrorResponse(op, res)
+	}
+
+	var r struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil || r.Task == "" {
+		return "", newMalformedResponseError("missing task")
+	}
+	log.Printf("%s: cascading %s %d as task %s\n", op, entity, id, r.Task)
+
+	return r.Task, nil
+}
+
+type esTaskStatus struct {
+	Total            int64 `json:"total"`
+	Updated          int64 `json:"updated"`
+	Noops            int64 `json:"noops"`
+	VersionConflicts int64 `json:"version_conflicts"`
+}
+
+type esTaskResponse struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status esTaskStatus `json:"status"`
+	} `json:"task"`
+	Response *struct {
+		esTaskStatus
+		Failures []json.RawMessage `json:"failures"`
+	} `json:"response"`
+	Error json.RawMessage `json:"error"`
+}
+
+// CascadeTask returns the progress of the cascade task taskID
+func (pr *productRepo) CascadeTask(ctx context.Context, taskID string) (*search.CascadeTask, error) {
+	res, err := pr.client.Tasks.Get(taskID, pr.client.Tasks.Get.WithContext(ctx))
+	if err != nil {
+		log.Printf("productRepo.CascadeTask: Error getting response: %s\n", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return nil, search.ErrTaskNotFound
+	}
+	if res.IsError() {
+		return nil, decodeErrorResponse("productRepo.CascadeTask", res)
+	}
+
+	var r esTaskResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, newMalformedResponseError("%s", err)
+	}
+
+	status := r.Task.Status
+	task := &search.CascadeTask{ID: taskID, Completed: r.Completed}
+	if r.Response != nil {
+		status = r.Response.esTaskStatus
+		for _, f := range r.Response.Failures {
+			task.Failures = append(task.Failures, string(f))
+		}
+	}
+	if len(r.Error) > 0 {
+		task.Failures = append(task.Failures, string(r.Error))
+	}
+	task.Total = status.Total
+	task.Updated = status.Updated
+	task.Noops = status.Noops
+	task.Conflicts = status.VersionConflicts
+
+	return task, nil
+}
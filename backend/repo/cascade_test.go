@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cascade", func() {
+	var (
+		trnsprt *fakeTransport
+		pr      ProductRepo
+	)
+
+	BeforeEach(func() {
+		trnsprt = &fakeTransport{status: http.StatusOK}
+		pr = NewProductRepo(newFakeClient(trnsprt), RepoNameProduct)
+	})
+
+	It("starts a throttled, versioned update by query of the products of a shop", func() {
+		trnsprt.response = `{"task": "node:42"}`
+
+		task, err := pr.CascadeShop(context.Background(), "pran", &search.Shop{ID: 5, Slug: "pran-rfl", ShopName: "Pran RFL", Version: 3})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(task).To(Equal("node:42"))
+		Expect(trnsprt.path).To(Equal("/" + writeAlias(RepoNameProduct) + "/_update_by_query"))
+		Expect(trnsprt.query).To(ContainSubstring("wait_for_completion=false"))
+		Expect(trnsprt.query).To(ContainSubstring("requests_per_second=500"))
+		Expect(trnsprt.query).To(ContainSubstring("conflicts=proceed"))
+		Expect(trnsprt.body).To(ContainSubstring(`{"term":{"shop_id":5}}`))
+		Expect(trnsprt.body).To(ContainSubstring(`"filter":[{"term":{"shop_slug":"pran"}}],"must_not":[{"exists":{"field":"shop_id"}}]`))
+		Expect(trnsprt.body).To(ContainSubstring(`"must_not":[{"range":{"shop_version":{"gte":3}}}]`))
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.shop_version = params.version`))
+		Expect(trnsprt.body).To(ContainSubstring(`"version":3`))
+	})
+
+	It("sets the shop approval of products by shop id or their slug without one", func() {
+		trnsprt.response = `{"updated": 3}`
+
+		Expect(pr.SetShopApproval(context.Background(), []*search.Shop{{ID: 5, Slug: "pran"}}, true)).To(Succeed())
+		Expect(trnsprt.path).To(Equal("/" + writeAlias(RepoNameProduct) + "/_update_by_query"))
+		Expect(trnsprt.body).To(ContainSubstring(`{"terms":{"shop_id":[5]}}`))
+		Expect(trnsprt.body).To(ContainSubstring(`"filter":[{"terms":{"shop_slug":["pran"]}}],"must_not":[{"exists":{"field":"shop_id"}}]`))
+	})
+
+	It("reports the progress of a cascade task", func() {
+		trnsprt.response = `{"completed": true, "task": {"status": {"total": 10}}, "response": {"total": 10, "updated": 7, "noops": 2, "version_conflicts": 1, "failures": []}}`
+
+		task, err := pr.CascadeTask(context.Background(), "node:42")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*task).To(Equal(search.CascadeTask{ID: "node:42", Completed: true, Total: 10, Updated: 7, Noops: 2, Conflicts: 1}))
+
+		trnsprt.status = http.StatusNotFound
+		_, err = pr.CascadeTask(context.Background(), "node:43")
+		Expect(err).To(MatchError(search.ErrTaskNotFound))
+	})
+})
@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+type categoryRepo struct {
+	*indexRepo[search.Category]
+}
+
+// CategoryRepo ...
+type CategoryRepo interface {
+	search.CategoryRepo
+	Repo
+	suggestGroup(req search.SuggestReq, size int, dst *[]*search.Highlighted[search.Category]) msearchGroup
+}
+
+// NewCategoryRepo returns a new categoryRepo
+func NewCategoryRepo(client *elasticsearch.Client, index string) CategoryRepo {
+	return &categoryRepo{
+		indexRepo: newIndexRepo(client, index, indexSpec[search.Category]{
+			name:     "categoryRepo",
+			mapping:  CategoryMapping,
+			settings: IndexSettings,
+			docID: func(c *search.Category) int64 {
+				return c.ID
+			},
+			searchFields: []string{
+				"name.search_as_type",
+				"name.search_as_type._2gram",
+				"name.search_as_type._3gram",
+			},
+			highlightFields: []string{"name.search_as_type"},
+			tieBreaker:      "id",
+		}),
+	}
+}
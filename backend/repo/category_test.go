@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CategoryRepo", func() {
+	var (
+		trnsprt *fakeTransport
+		cr      CategoryRepo
+	)
+
+	BeforeEach(func() {
+		trnsprt = &fakeTransport{status: http.StatusOK}
+		cr = NewCategoryRepo(newFakeClient(trnsprt), RepoNameCategory)
+	})
+
+	It("searches categories as you type on their name", func() {
+		trnsprt.response = `{"took": 1, "hits": {"total": {"value": 1}, "hits": [
+			{"_id": "3", "_source": {"id": 3, "name": "Mobiles", "parent_id": 1, "path": ["Electronics", "Mobiles"], "level": 1}}
+		]}}`
+
+		ctgs, info, err := cr.SearchAsType(context.Background(), "mob", search.Page{Limit: 10})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info).To(Equal(search.PageInfo{Total: 1}))
+		Expect(ctgs).To(HaveLen(1))
+		Expect(ctgs[0].Doc).To(Equal(&search.Category{ID: 3, Name: "Mobiles", ParentID: 1, Path: []string{"Electronics", "Mobiles"}, Level: 1}))
+		Expect(trnsprt.path).To(Equal("/" + RepoNameCategory + "/_search"))
+		Expect(trnsprt.body).To(ContainSubstring(`"fields":["name.search_as_type","name.search_as_type._2gram","name.search_as_type._3gram"]`))
+	})
+
+	It("bulk inserts categories under their id", func() {
+		trnsprt.response = `{"errors": false, "items": [{"index": {"_id": "3", "result": "created", "status": 201}}]}`
+
+		res, err := cr.BulkInsert(context.Background(), []*search.Category{{ID: 3, Name: "Mobiles", ParentID: 1}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Succeeded).To(Equal([]string{"3"}))
+		Expect(trnsprt.path).To(Equal("/" + writeAlias(RepoNameCategory) + "/_bulk"))
+		Expect(trnsprt.body).To(HavePrefix("{ \"index\" : { \"_id\" : \"3\" } }\n"))
+		Expect(trnsprt.body).To(ContainSubstring(`"parent_id":1`))
+	})
+
+	It("updates categories by a versioned upsert", func() {
+		trnsprt.response = `{"errors": true, "items": [
+			{"update": {"_id": "3", "result": "updated", "status": 200}},
+			{"update": {"_id": "4", "status": 409, "error": {"type": "version_conflict_engine_exception", "reason": "conflict"}}}
+		]}`
+
+		res, err := cr.UpdateMany(context.Background(), []*search.Category{{ID: 3, Name: "Phones", Version: 2}, {ID: 4, Version: 1}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Succeeded).To(Equal([]string{"3"}))
+		Expect(res.Failed).To(HaveLen(1))
+		Expect(res.Failed[0].ID).To(Equal("4"))
+		Expect(trnsprt.path).To(Equal("/" + writeAlias(RepoNameCategory) + "/_bulk"))
+		Expect(trnsprt.body).To(ContainSubstring(`{ "update" : { "_id" : "3" } }`))
+		Expect(trnsprt.body).To(ContainSubstring(`if (ctx._source.version < params.version)`))
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.name=params.name`))
+		Expect(trnsprt.body).To(ContainSubstring(`"upsert": {"id":3`))
+	})
+
+	It("skips updates of a version not newer than the stored one", func() {
+		trnsprt.response = `{"errors": false, "items": [
+			{"update": {"_id": "3", "result": "noop", "status": 200}}
+		]}`
+
+		res, err := cr.UpdateMany(context.Background(), []*search.Category{{ID: 3, Name: "Phones", Version: 1}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trnsprt.body).To(ContainSubstring(`} else { ctx.op = 'noop' }"`))
+		Expect(res.Succeeded).To(BeEmpty())
+		Expect(res.Skipped).To(Equal([]string{"3"}))
+	})
+
+	It("deletes categories by id", func() {
+		trnsprt.response = `{"errors": false, "items": [
+			{"delete": {"_id": "3", "result": "deleted", "status": 200}},
+			{"delete": {"_id": "4", "result": "not_found", "status": 404}}
+		]}`
+
+		res, err := cr.DeleteMany(context.Background(), []int64{3, 4})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Succeeded).To(Equal([]string{"3"}))
+		Expect(res.Skipped).To(Equal([]string{"4"}))
+		Expect(trnsprt.path).To(Equal("/" + writeAlias(RepoNameCategory) + "/_bulk"))
+		Expect(trnsprt.body).To(Equal("{ \"delete\" : { \"_id\" : \"3\" } }\n{ \"delete\" : { \"_id\" : \"4\" } }\n"))
+	})
+})
@@ -0,0 +1,113 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// categoryPathSeparator joins the category names of a path into a level value
+const categoryPathSeparator = " > "
+
+// categoryLevelField returns the field holding the category path down to depth
+func categoryLevelField(depth int) string {
+	return fmt.Sprintf("category_levels.lvl%d", depth)
+}
+
+// categoryLevels maps a category path to the value of every level, i.e.
+// [Electronics Phones] => lvl0: Electronics, lvl1: Electronics > Phones
+func categoryLevels(path []string) map[string]string {
+	lvls := make(map[string]string, len(path))
+	for i := range path {
+		lvls[fmt.Sprintf("lvl%d", i)] = strings.Join(path[:i+1], categoryPathSeparator)
+	}
+
+	return lvls
+}
+
+// categoryPathFilter matches the products in path or any category below it
+func categoryPathFilter(path []string) map[string]interface{} {
+	if len(path) == 0 {
+		return map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		}
+	}
+
+	return map[string]interface{}{
+		"term": map[string]interface{}{
+			categoryLevelField(len(path) - 1): strings.Join(path, categoryPathSeparator),
+		},
+	}
+}
+
+// categoryTreeAgg counts every category of the selected path and the
+// categories of the level below it, over the documents matching filters
+func categoryTreeAgg(filters []map[string]interface{}, path []string, size int) map[string]interface{} {
+	aggs := map[string]interface{}{
+		"children": map[string]interface{}{
+			"filter": categoryPathFilter(path),
+			"aggs": map[string]interface{}{
+				"children_filtered": map[string]interface{}{
+					"terms": map[string]interface{}{
+						"field": categoryLevelField(len(path)),
+						"size":  size,
+					},
+				},
+			},
+		},
+	}
+	for depth := range path {
+		aggs[fmt.Sprintf("lvl%d", depth)] = map[string]interface{}{
+			"filter": categoryPathFilter(path[:depth+1]),
+		}
+	}
+
+	return map[string]interface{}{
+		"filter": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
+			},
+		},
+		"aggs": aggs,
+	}
+}
+
+// categoryTree decodes the aggregation built by categoryTreeAgg into nested
+// buckets, one per category of the selected path with the level below the
+// selection as children of the deepest one
+func categoryTree(r *esSearchResponse, path []string) ([]search.CategoryBucket, error) {
+	bckts, err := r.termsBuckets("category_tree", "children", "children_filtered")
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := ""
+	if len(path) > 0 {
+		prefix = strings.Join(path, categoryPathSeparator) + categoryPathSeparator
+	}
+	tree := make([]search.CategoryBucket, 0, len(bckts))
+	for _, b := range bckts {
+		key := strings.TrimPrefix(b.Key, prefix)
+		tree = append(tree, search.CategoryBucket{
+			Key:      key,
+			Path:     append(append([]string{}, path...), key),
+			DocCount: b.DocCount,
+		})
+	}
+
+	for depth := len(path) - 1; depth >= 0; depth-- {
+		var agg esFilterAgg
+		if err := r.aggregation(&agg, "category_tree", fmt.Sprintf("lvl%d", depth)); err != nil {
+			return nil, err
+		}
+		tree = []search.CategoryBucket{{
+			Key:      path[depth],
+			Path:     append([]string{}, path[:depth+1]...),
+			DocCount: agg.DocCount,
+			Children: tree,
+		}}
+	}
+
+	return tree, nil
+}
@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CategoryTree", func() {
+	It("maps a category path to its levels", func() {
+		Expect(categoryLevels([]string{"Electronics", "Phones", "Android"})).To(Equal(map[string]string{
+			"lvl0": "Electronics",
+			"lvl1": "Electronics > Phones",
+			"lvl2": "Electronics > Phones > Android",
+		}))
+	})
+
+	It("nests the level below the selection under the selected path", func() {
+		body := `{
+			"hits": {"total": {"value": 3}, "hits": []},
+			"aggregations": {
+				"category_tree": {
+					"doc_count": 9,
+					"lvl0": {"doc_count": 7},
+					"lvl1": {"doc_count": 5},
+					"children": {
+						"doc_count": 5,
+						"children_filtered": {"buckets": [
+							{"key": "Electronics > Phones > Android", "doc_count": 3},
+							{"key": "Electronics > Phones > iOS", "doc_count": 2}
+						]}
+					}
+				}
+			}
+		}`
+		r, err := decodeSearchResponse(strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+
+		tree, err := categoryTree(r, []string{"Electronics", "Phones"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tree).To(Equal([]search.CategoryBucket{{
+			Key:      "Electronics",
+			Path:     []string{"Electronics"},
+			DocCount: 7,
+			Children: []search.CategoryBucket{{
+				Key:      "Phones",
+				Path:     []string{"Electronics", "Phones"},
+				DocCount: 5,
+				Children: []search.CategoryBucket{
+					{Key: "Android", Path: []string{"Electronics", "Phones", "Android"}, DocCount: 3},
+					{Key: "iOS", Path: []string{"Electronics", "Phones", "iOS"}, DocCount: 2},
+				},
+			}},
+		}}))
+	})
+})
@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// tags the matched text of highlighted fragments is wrapped in
+const (
+	highlightPreTag  = "<em>"
+	highlightPostTag = "</em>"
+)
+
+// applyHighlight highlights fields in the hits of query
+func applyHighlight(query map[string]interface{}, fields []string) {
+	hf := map[string]interface{}{}
+	for _, f := range fields {
+		hf[f] = map[string]interface{}{}
+	}
+
+	query["highlight"] = map[string]interface{}{
+		"pre_tags":  []string{highlightPreTag},
+		"post_tags": []string{highlightPostTag},
+		"fields":    hf,
+	}
+}
+
+// hitHighlight keys the fragments of hit by the document field they are
+// from, fragments of a multi field such as name.search_as_type go to name
+func hitHighlight(hit esHit) map[string][]string {
+	hl := map[string][]string{}
+	for f, frags := range hit.Highlight {
+		f = strings.SplitN(f, ".", 2)[0]
+		hl[f] = append(hl[f], frags...)
+	}
+
+	return hl
+}
+
+// highlighted pairs docs with the highlight of the hits they were decoded from
+func highlighted[T any](docs []*T, hits []esHit) []*search.Highlighted[T] {
+	res := make([]*search.Highlighted[T], 0, len(docs))
+	for i, doc := range docs {
+		res = append(res, &search.Highlighted[T]{Doc: doc, Highlight: hitHighlight(hits[i])})
+	}
+
+	return res
+}
@@ -0,0 +1,644 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+// indexSpec describes an index and the per document hooks an entity
+// provides to get index management, bulk writes and search as you type
+type indexSpec[T any] struct {
+	// name prefixes log lines, i.e. brandRepo
+	name string
+	// mapping of the index
+	mapping string
+	// settings the index is created with
+	settings string
+	// docID returns the id the document is stored under
+	docID func(*T) int64
+	// document maps an entity to the indexed document, the entity itself
+	// is indexed when it is nil
+	document func(*T) interface{}
+	// searchFields are the fields search as you type runs against
+	searchFields []string
+	// highlightFields are highlighted in search results
+	highlightFields []string
+	// visibility are the filters a document has to pass for shoppers to
+	// find it, searches including hidden documents skip them
+	visibility []map[string]interface{}
+	// tieBreaker is a field unique per document, it makes the sort of
+	// cursor pages total
+	tieBreaker string
+}
+
+// errUnaliasedIndex is returned for an index that predates the aliases,
+// Reindex moves it behind them
+var errUnaliasedIndex = errors.New("index rather than an alias, reindex to move it behind aliases")
+
+// indexRepo implements everything the entity repos share on top of an indexSpec,
+// it reads through the index alias and writes through its write alias
+type indexRepo[T any] struct {
+	index      string
+	writeIndex string
+	client     *elasticsearch.Client
+	spec       indexSpec[T]
+}
+
+func newIndexRepo[T any](client *elasticsearch.Client, index string, spec indexSpec[T]) *indexRepo[T] {
+	return &indexRepo[T]{
+		index:      index,
+		writeIndex: writeAlias(index),
+		client:     client,
+		spec:       spec,
+	}
+}
+
+func (ir *indexRepo[T]) op(name string) string {
+	return ir.spec.name + "." + name
+}
+
+func (ir *indexRepo[T]) document(doc *T) ([]byte, error) {
+	if ir.spec.document == nil {
+		return json.Marshal(doc)
+	}
+
+	return json.Marshal(ir.spec.document(doc))
+}
+
+// EnsureMapping puts the mapping on the indices behind both aliases, only
+// additive changes are accepted, others need a reindex
+func (ir *indexRepo[T]) EnsureMapping(ctx context.Context) error {
+	log.Println("creating mappings for ", ir.index)
+	res, err := ir.client.Indices.PutMapping(
+		strings.NewReader(ir.spec.mapping),
+		ir.client.Indices.PutMapping.WithIndex(ir.index, ir.writeIndex),
+		ir.client.Indices.PutMapping.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse(ir.op("EnsureMapping"), res)
+	}
+
+	return nil
+}
+
+// EnsureIndex creates the first version of the index and its aliases
+func (ir *indexRepo[T]) EnsureIndex(ctx context.Context) error {
+	idxs, err := aliasIndices(ctx, ir.client, ir.index)
+	if err != nil {
+		return err
+	}
+	if len(idxs) > 0 {
+		return nil
+	}
+
+	exists, err := indexExists(ctx, ir.client, ir.index)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("%s: %w", ir.index, errUnaliasedIndex)
+	}
+
+	idx, err := ir.createNextIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	return updateAliases(ctx, ir.client, addAlias(idx, ir.index), addAlias(idx, ir.writeIndex))
+}
+
+func (ir *indexRepo[T]) EnsureIndexAndMapping(ctx context.Context) error {
+	if err := ir.EnsureIndex(ctx); err != nil {
+		return err
+	}
+
+	return ir.EnsureMapping(ctx)
+}
+
+// createNextIndex creates the version after the latest one with the
+// settings and mapping of the spec
+func (ir *indexRepo[T]) createNextIndex(ctx context.Context) (string, error) {
+	vs, err := indexVersions(ctx, ir.client, ir.index)
+	if err != nil {
+		return "", err
+	}
+	v := 1
+	if len(vs) > 0 {
+		v = vs[len(vs)-1] + 1
+	}
+	idx := versionedIndex(ir.index, v)
+
+	body := fmt.Sprintf(`{"mappings": %s}`, ir.spec.mapping)
+	if ir.spec.settings != "" {
+		body = fmt.Sprintf(`{"settings": %s, "mappings": %s}`, ir.spec.settings, ir.spec.mapping)
+	}
+
+	log.Println("creating new index ", idx)
+	res, err := ir.client.Indices.Create(
+		idx,
+		ir.client.Indices.Create.WithBody(strings.NewReader(body)),
+		ir.client.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println(err)
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return "", decodeErrorResponse(ir.op("createNextIndex"), res)
+	}
+
+	return idx, nil
+}
+
+// Reindex moves the documents into a new version of the index built from the
+// current spec, without downtime of reads:
+//
+//  1. the next version is created and the documents of the current write
+//     index are copied into it, writes keep going to the current index
+//  2. writes to the current index are blocked for the catch up, the
+//     documents written during the copy are copied again and the documents
+//     deleted meanwhile are deleted from the new version
+//  3. document counts are compared, aliases stay on the current index if
+//     they differ
+//  4. reads and writes are switched atomically and the block is lifted
+//
+// Writes failing while blocked are retried by their clients, the worker
+// retries them with backoff. Nothing is switched when a step fails, the new
+// version is deleted again. The previous version is kept for Rollback. An
+// index that predates the aliases is copied and then replaced by the read
+// alias.
+func (ir *indexRepo[T]) Reindex(ctx context.Context) error {
+	srcs, err := aliasIndices(ctx, ir.client, ir.writeIndex)
+	if err != nil {
+		return err
+	}
+
+	legacy := false
+	if len(srcs) != 1 {
+		exists, err := indexExists(ctx, ir.client, ir.index)
+		if err != nil {
+			return err
+		}
+		if len(srcs) > 1 || !exists {
+			return fmt.Errorf("%s doesn't point to a single index, run migration up first", ir.writeIndex)
+		}
+		srcs, legacy = []string{ir.index}, true
+	}
+	src := srcs[0]
+
+	// documents up to the checkpoint are visible to the copy once src is
+	// refreshed, the ones after it are copied by the catch up
+	checkpoint, err := localCheckpoint(ctx, ir.client, src)
+	if err != nil {
+		return err
+	}
+	if err := refreshIndex(ctx, ir.client, src); err != nil {
+		return err
+	}
+
+	dst, err := ir.createNextIndex(ctx)
+	if err != nil {
+		return err
+	}
+	switched := false
+	defer func() {
+		// cleaning up must not depend on ctx, which may be why it failed
+		cctx, cancel := context.WithTimeout(context.Background(), reindexCleanupTimeout)
+		defer cancel()
+		if !(legacy && switched) {
+			if uerr := setWriteBlock(cctx, ir.client, src, false); uerr != nil {
+				log.Printf("couldn't unblock writes to %s, unblock it by hand: %s\n", src, uerr)
+			}
+		}
+		if !switched {
+			if derr := deleteIndex(cctx, ir.client, dst); derr != nil {
+				log.Printf("couldn't delete %s after failing to reindex %s: %s\n", dst, ir.index, derr)
+			}
+		}
+	}()
+
+	if err := reindexDocs(ctx, ir.client, src, dst, nil); err != nil {
+		return err
+	}
+
+	log.Printf("blocking writes to %s to catch up on the writes since the copy\n", src)
+	if err := setWriteBlock(ctx, ir.client, src, true); err != nil {
+		return err
+	}
+	if err := refreshIndex(ctx, ir.client, src); err != nil {
+		return err
+	}
+	if err := reindexDocs(ctx, ir.client, src, dst, map[string]interface{}{
+		"range": map[string]interface{}{"_seq_no": map[string]interface{}{"gt": checkpoint}},
+	}); err != nil {
+		return err
+	}
+
+	srcCount, err := countDocs(ctx, ir.client, src)
+	if err != nil {
+		return err
+	}
+	dstCount, err := countDocs(ctx, ir.client, dst)
+	if err != nil {
+		return err
+	}
+	// every document of src is in dst, extra ones were deleted during the copy
+	if dstCount > srcCount {
+		if err := pruneDocs(ctx, ir.client, src, dst); err != nil {
+			return err
+		}
+		if dstCount, err = countDocs(ctx, ir.client, dst); err != nil {
+			return err
+		}
+	}
+	if dstCount != srcCount {
+		return fmt.Errorf("%s has %d documents but %s %d, aliases stay on %s", src, srcCount, dst, dstCount, src)
+	}
+
+	actions := []map[string]interface{}{addAlias(dst, ir.index), addAlias(dst, ir.writeIndex)}
+	if legacy {
+		actions = append(actions, map[string]interface{}{
+			"remove_index": map[string]interface{}{"index": src},
+		})
+	} else {
+		rdIdxs, err := aliasIndices(ctx, ir.client, ir.index)
+		if err != nil {
+			return err
+		}
+		for _, idx := range rdIdxs {
+			actions = append(actions, removeAlias(idx, ir.index))
+		}
+		actions = append(actions, removeAlias(src, ir.writeIndex))
+	}
+	if err := updateAliases(ctx, ir.client, actions...); err != nil {
+		return err
+	}
+	switched = true
+	log.Printf("reads and writes of %s switched from %s to %s, %d documents\n", ir.index, src, dst, dstCount)
+
+	return nil
+}
+
+// Rollback switches reads and writes back to the version before the one
+// reads currently go to. Documents written since the switch only exist in
+// the newer version.
+func (ir *indexRepo[T]) Rollback(ctx context.Context) error {
+	rdIdxs, err := aliasIndices(ctx, ir.client, ir.index)
+	if err != nil {
+		return err
+	}
+	if len(rdIdxs) != 1 {
+		return fmt.Errorf("%s doesn't point to a single index", ir.index)
+	}
+	cur, ok := indexVersion(ir.index, rdIdxs[0])
+	if !ok {
+		return fmt.Errorf("%s points to %s which isn't versioned", ir.index, rdIdxs[0])
+	}
+
+	vs, err := indexVersions(ctx, ir.client, ir.index)
+	if err != nil {
+		return err
+	}
+	prev := 0
+	for _, v := range vs {
+		if v < cur {
+			prev = v
+		}
+	}
+	if prev == 0 {
+		return fmt.Errorf("%s has no version before %s", ir.index, rdIdxs[0])
+	}
+	dst := versionedIndex(ir.index, prev)
+
+	wrtIdxs, err := aliasIndices(ctx, ir.client, ir.writeIndex)
+	if err != nil {
+		return err
+	}
+	actions := []map[string]interface{}{
+		removeAlias(rdIdxs[0], ir.index),
+		addAlias(dst, ir.index),
+		addAlias(dst, ir.writeIndex),
+	}
+	for _, idx := range wrtIdxs {
+		if idx != dst {
+			actions = append(actions, removeAlias(idx, ir.writeIndex))
+		}
+	}
+	if err := updateAliases(ctx, ir.client, actions...); err != nil {
+		return err
+	}
+	log.Printf("reads and writes of %s rolled back to %s\n", ir.index, dst)
+
+	return nil
+}
+
+func (ir *indexRepo[T]) BulkInsert(ctx context.Context, docs []*T) (*search.BulkResult, error) {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		jDoc, err := ir.document(doc)
+		if err != nil {
+			log.Printf("%s: Error encoding document: %s\n", ir.op("BulkInsert"), err)
+			return nil, err
+		}
+		jDoc = append(jDoc, "\n"...)
+		meta := []byte(fmt.Sprintf(`{ "index" : { "_id" : "%d" } }%s`, ir.spec.docID(doc), "\n"))
+		buf.Grow(len(meta) + len(jDoc))
+		buf.Write(meta)
+		buf.Write(jDoc)
+	}
+
+	return ir.bulk(ctx, ir.op("BulkInsert"), buf.Bytes())
+}
+
+func (ir *indexRepo[T]) UpdateMany(ctx context.Context, docs []*T) (*search.BulkResult, error) {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		jDoc, err := ir.document(doc)
+		if err != nil {
+			log.Printf("%s: Error encoding document: %s\n", ir.op("UpdateMany"), err)
+			return nil, err
+		}
+		meta := []byte(fmt.Sprintf(`{ "update" : { "_id" : "%d" } }%s`, ir.spec.docID(doc), "\n"))
+		buf.Grow(len(meta) + len(jDoc))
+		buf.Write(meta)
+		buf.Write(getConcurrencyControlledUpdateQuery(jDoc, string(jDoc)))
+	}
+
+	return ir.bulk(ctx, ir.op("UpdateMany"), buf.Bytes())
+}
+
+// GetMany returns the documents stored under ids, ids not found are left out
+func (ir *indexRepo[T]) GetMany(ctx context.Context, ids []int64) ([]*T, error) {
+	if len(ids) == 0 {
+		return []*T{}, nil
+	}
+
+	strIDS := make([]string, 0, len(ids))
+	for _, id := range ids {
+		strIDS = append(strIDS, fmt.Sprintf("%d", id))
+	}
+	body, err := json.Marshal(map[string]interface{}{"ids": strIDS})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := ir.client.Mget(
+		bytes.NewReader(body),
+		ir.client.Mget.WithIndex(ir.index),
+		ir.client.Mget.WithContext(ctx),
+	)
+	if err != nil {
+		log.Printf("%s: Error getting response: %s\n", ir.op("GetMany"), err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, decodeErrorResponse(ir.op("GetMany"), res)
+	}
+
+	var r struct {
+		Docs []struct {
+			esHit
+			Found bool `json:"found"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, newMalformedResponseError("%s", err)
+	}
+
+	hits := []esHit{}
+	for _, d := range r.Docs {
+		if d.Found {
+			hits = append(hits, d.esHit)
+		}
+	}
+
+	return ir.sources(ir.op("GetMany"), hits)
+}
+
+func (ir *indexRepo[T]) DeleteMany(ctx context.Context, ids []int64) (*search.BulkResult, error) {
+	var buf bytes.Buffer
+	for _, id := range ids {
+		meta := []byte(fmt.Sprintf(`{ "delete" : { "_id" : "%d" } }%s`, id, "\n"))
+		buf.Grow(len(meta))
+		buf.Write(meta)
+	}
+
+	return ir.bulk(ctx, ir.op("DeleteMany"), buf.Bytes())
+}
+
+// bulk sends body to the _bulk api of the index and reports the outcome of every document
+func (ir *indexRepo[T]) bulk(ctx context.Context, op string, body []byte) (*search.BulkResult, error) {
+	req := esapi.BulkRequest{
+		Index: ir.writeIndex,
+		Body:  bytes.NewReader(body),
+	}
+
+	res, err := req.Do(ctx, ir.client)
+	if err != nil {
+		log.Printf("%s: Error sending query: %s\n", op, err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, decodeErrorResponse(op, res)
+	}
+
+	bres, err := decodeBulkResponse(res.Body)
+	if err != nil {
+		log.Printf("%s: Error decoding success response: %s\n", op, err)
+		return nil, err
+	}
+	log.Printf("[%s] %d succeeded, %d skipped, %d failed\n", res.Status(), len(bres.Succeeded), len(bres.Skipped), len(bres.Failed))
+
+	return bres, nil
+}
+
+func (ir *indexRepo[T]) SearchAsType(ctx context.Context, term string, page search.Page) ([]*search.Highlighted[T], search.PageInfo, error) {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"multi_match": map[string]interface{}{
+				"query":  term,
+				"type":   "bool_prefix",
+				"fields": ir.spec.searchFields,
+			},
+		},
+	}
+
+	r, info, err := ir.searchPage(ctx, ir.op("SearchAsType"), query, page)
+	if err != nil {
+		return nil, search.PageInfo{}, err
+	}
+
+	docs, err := ir.hits(ir.op("SearchAsType"), r.Hits.Hits)
+	if err != nil {
+		return nil, search.PageInfo{}, err
+	}
+
+	return docs, info, nil
+}
+
+// searchPage runs query for page, either by offset or by cursor. Cursor
+// pages are read from a point in time with search_after, the tie breaker is
+// appended to the sort of query so that every position is unique.
+func (ir *indexRepo[T]) searchPage(ctx context.Context, op string, query map[string]interface{}, page search.Page) (*esSearchResponse, search.PageInfo, error) {
+	if page.Highlight {
+		applyHighlight(query, ir.spec.highlightFields)
+	}
+	if !page.IncludeHidden {
+		applyVisibility(query, ir.spec.visibility)
+	}
+
+	if page.Cursor == nil {
+		query["from"] = page.Skip
+		query["size"] = page.Limit
+
+		r, err := ir.search(ctx, op, query)
+		if err != nil {
+			return nil, search.PageInfo{}, err
+		}
+
+		return r, search.PageInfo{Total: r.Hits.Total.Value}, nil
+	}
+
+	c, err := decodeCursor(*page.Cursor)
+	if err != nil {
+		return nil, search.PageInfo{}, err
+	}
+	if c.PitID == "" {
+		if c.PitID, err = ir.openPIT(ctx); err != nil {
+			return nil, search.PageInfo{}, err
+		}
+	}
+
+	srt, _ := query["sort"].([]map[string]interface{})
+	if len(srt) == 0 {
+		srt = []map[string]interface{}{sortBy("_score", "desc")}
+	}
+	query["sort"] = append(append([]map[string]interface{}{}, srt...), sortBy(ir.spec.tieBreaker, "asc"))
+	query["size"] = page.Limit
+	query["pit"] = map[string]interface{}{
+		"id":         c.PitID,
+		"keep_alive": pitKeepAlive,
+	}
+	if len(c.After) > 0 {
+		query["search_after"] = c.After
+	}
+
+	r, err := ir.search(ctx, op, query)
+	if err != nil {
+		if isContextMissing(err) {
+			return nil, search.PageInfo{}, search.ErrInvalidCursor
+		}
+		return nil, search.PageInfo{}, err
+	}
+
+	info := search.PageInfo{Total: r.Hits.Total.Value}
+	pitID := r.PitID
+	if pitID == "" {
+		pitID = c.PitID
+	}
+
+	hits := r.Hits.Hits
+	if len(hits) == 0 || int64(len(hits)) < page.Limit {
+		ir.closePIT(ctx, pitID)
+		return r, info, nil
+	}
+
+	info.NextCursor, err = encodeCursor(cursor{PitID: pitID, After: hits[len(hits)-1].Sort})
+	if err != nil {
+		return nil, search.PageInfo{}, err
+	}
+
+	return r, info, nil
+}
+
+// search runs query against the index, or against the point in time of
+// the query if it has one
+func (ir *indexRepo[T]) search(ctx context.Context, op string, query map[string]interface{}) (*esSearchResponse, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		log.Printf("%s: Error encoding query: %s\n", op, err)
+		return nil, err
+	}
+
+	opts := []func(*esapi.SearchRequest){
+		ir.client.Search.WithContext(ctx),
+		ir.client.Search.WithBody(&buf),
+		ir.client.Search.WithTrackTotalHits(true),
+	}
+	// a point in time already names the index
+	if _, ok := query["pit"]; !ok {
+		opts = append(opts, ir.client.Search.WithIndex(ir.index))
+	}
+
+	res, err := ir.client.Search(opts...)
+	if err != nil {
+		log.Printf("%s: Error sending query to server: %s\n", op, err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return nil, decodeErrorResponse(op, res)
+	}
+
+	r, err := decodeSearchResponse(res.Body)
+	if err != nil {
+		log.Printf("%s: Error decoding success response: %s\n", op, err)
+		return nil, err
+	}
+
+	log.Printf(
+		"[%s] %d hits; took: %dms\n",
+		res.Status(),
+		r.Hits.Total.Value,
+		r.Took,
+	)
+
+	return r, nil
+}
+
+// hits decodes the documents of hits along with their highlight
+func (ir *indexRepo[T]) hits(op string, hits []esHit) ([]*search.Highlighted[T], error) {
+	docs, err := ir.sources(op, hits)
+	if err != nil {
+		return nil, err
+	}
+
+	return highlighted(docs, hits), nil
+}
+
+// sources decodes the _source of every hit
+func (ir *indexRepo[T]) sources(op string, hits []esHit) ([]*T, error) {
+	docs := make([]*T, 0, len(hits))
+	for _, hit := range hits {
+		var doc T
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			log.Printf("%s: Error decoding response: %s\n", op, err)
+			return nil, newMalformedResponseError("hit %s: %s", hit.ID, err)
+		}
+		docs = append(docs, &doc)
+	}
+
+	return docs, nil
+}
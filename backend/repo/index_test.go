@@ -0,0 +1,154 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/elastic/go-elasticsearch/v7"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeTransport records the last request and answers with a canned response
+type fakeTransport struct {
+	status   int
+	response string
+	path     string
+	query    string
+	body     string
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.path = req.URL.Path
+	t.query = req.URL.RawQuery
+	t.body = ""
+	if req.Body != nil {
+		b, _ := ioutil.ReadAll(req.Body)
+		t.body = string(b)
+	}
+
+	return &http.Response{
+		StatusCode: t.status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(t.response)),
+	}, nil
+}
+
+func newFakeClient(t *fakeTransport) *elasticsearch.Client {
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Transport: t})
+	Expect(err).ToNot(HaveOccurred())
+
+	return client
+}
+
+var _ = Describe("IndexRepo", func() {
+	var (
+		trnsprt *fakeTransport
+		ir      *indexRepo[search.Brand]
+	)
+
+	BeforeEach(func() {
+		trnsprt = &fakeTransport{status: http.StatusOK}
+		ir = newIndexRepo(newFakeClient(trnsprt), "brands", indexSpec[search.Brand]{
+			name:    "brandRepo",
+			mapping: BrandMapping,
+			docID: func(b *search.Brand) int64 {
+				return b.ID
+			},
+			document: func(b *search.Brand) interface{} {
+				return map[string]interface{}{"id": b.ID, "name": strings.ToUpper(b.Name)}
+			},
+			searchFields: []string{"name.search_as_type"},
+			tieBreaker:   "id",
+		})
+	})
+
+	It("bulk inserts documents under their id through the document hook", func() {
+		trnsprt.response = `{"errors": false, "items": [{"index": {"_id": "7", "result": "created", "status": 201}}]}`
+
+		res, err := ir.BulkInsert(context.Background(), []*search.Brand{{ID: 7, Name: "walton"}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Succeeded).To(Equal([]string{"7"}))
+
+		Expect(trnsprt.path).To(Equal("/brands_write/_bulk"))
+		Expect(trnsprt.body).To(Equal("{ \"index\" : { \"_id\" : \"7\" } }\n{\"id\":7,\"name\":\"WALTON\"}\n"))
+	})
+
+	It("searches as you type on the search fields", func() {
+		trnsprt.response = `{"took": 1, "hits": {"total": {"value": 1}, "hits": [{"_id": "7", "_source": {"id": 7, "name": "walton"}}]}}`
+
+		brnds, info, err := ir.SearchAsType(context.Background(), "wal", search.Page{Limit: 10})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info).To(Equal(search.PageInfo{Total: 1}))
+		Expect(brnds).To(HaveLen(1))
+		Expect(brnds[0].Doc).To(Equal(&search.Brand{ID: 7, Name: "walton"}))
+		Expect(trnsprt.body).To(ContainSubstring(`"fields":["name.search_as_type"]`))
+		Expect(trnsprt.body).NotTo(ContainSubstring(`"highlight"`))
+	})
+
+	It("filters hidden documents out unless they are included", func() {
+		ir.spec.visibility = []map[string]interface{}{{"term": map[string]interface{}{"approval": 1}}}
+		trnsprt.response = `{"took": 1, "hits": {"total": {"value": 0}, "hits": []}}`
+
+		_, _, err := ir.SearchAsType(context.Background(), "wal", search.Page{Limit: 10})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trnsprt.body).To(ContainSubstring(`"filter":[{"term":{"approval":1}}]`))
+
+		_, _, err = ir.SearchAsType(context.Background(), "wal", search.Page{Limit: 10, IncludeHidden: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trnsprt.body).NotTo(ContainSubstring(`"filter"`))
+	})
+
+	It("highlights the matched fragments when asked to", func() {
+		ir.spec.highlightFields = []string{"name.search_as_type"}
+		trnsprt.response = `{"took": 1, "hits": {"total": {"value": 1}, "hits": [
+			{"_id": "7", "_source": {"id": 7, "name": "walton"}, "highlight": {"name.search_as_type": ["<em>wal</em>ton"]}}
+		]}}`
+
+		brnds, _, err := ir.SearchAsType(context.Background(), "wal", search.Page{Limit: 10, Highlight: true})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trnsprt.body).To(ContainSubstring(`"highlight":{"fields":{"name.search_as_type":{}}`))
+		Expect(brnds[0].Highlight).To(Equal(map[string][]string{"name": {"<em>wal</em>ton"}}))
+	})
+
+	It("continues a cursor page after the last hit on the point in time", func() {
+		trnsprt.response = `{"took": 1, "pit_id": "pit-2", "hits": {"total": {"value": 5}, "hits": [
+			{"_id": "7", "_source": {"id": 7}, "sort": [1.5, 7]},
+			{"_id": "9", "_source": {"id": 9}, "sort": [1.2, 9]}
+		]}}`
+		crsr, err := encodeCursor(cursor{PitID: "pit-1", After: []json.RawMessage{json.RawMessage("1.7"), json.RawMessage("3")}})
+		Expect(err).ToNot(HaveOccurred())
+
+		brnds, info, err := ir.SearchAsType(context.Background(), "wal", search.Page{Limit: 2, Cursor: &crsr})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(brnds).To(HaveLen(2))
+		Expect(info.Total).To(Equal(int64(5)))
+		Expect(trnsprt.path).To(Equal("/_search"))
+		Expect(trnsprt.body).To(ContainSubstring(`"search_after":[1.7,3]`))
+		Expect(trnsprt.body).To(ContainSubstring(`"pit":{"id":"pit-1","keep_alive":"1m"}`))
+
+		next, err := decodeCursor(info.NextCursor)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(next.PitID).To(Equal("pit-2"))
+		Expect(next.After).To(Equal([]json.RawMessage{json.RawMessage("1.2"), json.RawMessage("9")}))
+	})
+
+	It("rejects malformed cursors", func() {
+		crsr := "not-a-cursor"
+		_, _, err := ir.SearchAsType(context.Background(), "wal", search.Page{Limit: 2, Cursor: &crsr})
+		Expect(err).To(Equal(search.ErrInvalidCursor))
+	})
+
+	It("returns error responses as ESResponseError", func() {
+		trnsprt.status = http.StatusBadRequest
+		trnsprt.response = `{"error": {"type": "illegal_argument_exception", "reason": "bad"}, "status": 400}`
+
+		_, err := ir.DeleteMany(context.Background(), []int64{7})
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("query returned error"))
+	})
+})
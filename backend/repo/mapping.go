@@ -2,6 +2,16 @@ package repo
 
 // ProductMapping ...
 const ProductMapping = `{
+	"dynamic_templates" : [
+	  {
+		"category_levels" : {
+		  "path_match" : "category_levels.*",
+		  "mapping" : {
+			"type" : "keyword"
+		  }
+		}
+	  }
+	],
 	"properties" : {
 	  "id" : {
 		"type" : "integer"
@@ -14,14 +24,26 @@ const ProductMapping = `{
 	  },
 	  "name" : {
 		"type" : "text",
+		"analyzer" : "catalog_index",
+		"search_analyzer" : "catalog_search",
 		"fields" : {
 		  "keyword" : {
 			"type" : "keyword"
+		  },
+		  "suggest" : {
+			"type" : "text",
+			"analyzer" : "catalog_suggest"
+		  },
+		  "shingle" : {
+			"type" : "text",
+			"analyzer" : "catalog_shingle"
 		  }
 		}
 	  },
 	  "shop_name" : {
 		"type" : "text",
+		"analyzer" : "catalog_index",
+		"search_analyzer" : "catalog_search",
 		"fields" : {
 		  "keyword" : {
 			"type" : "keyword",
@@ -32,23 +54,43 @@ const ProductMapping = `{
 	  "shop_slug" : {
 		"type" : "keyword"
 	  },
+	  "shop_id" : {
+		"type" : "long"
+	  },
+	  "shop_version" : {
+		"type" : "long"
+	  },
 	  "shop_item_id" : {
 		"type" : "integer"
 	  },
 	  "brand_name" : {
 		"type" : "text",
+		"analyzer" : "catalog_index",
+		"search_analyzer" : "catalog_search",
 		"fields" : {
 		  "keyword" : {
 			"type" : "keyword",
 			"ignore_above" : 256
+		  },
+		  "suggest" : {
+			"type" : "text",
+			"analyzer" : "catalog_suggest"
 		  }
 		}
 	  },
 	  "brand_slug" : {
 		"type" : "keyword"
 	  },
+	  "brand_id" : {
+		"type" : "long"
+	  },
+	  "brand_version" : {
+		"type" : "long"
+	  },
 	  "category_name" : {
 		"type" : "text",
+		"analyzer" : "catalog_index",
+		"search_analyzer" : "catalog_search",
 		"fields" : {
 		  "keyword" : {
 			"type" : "keyword",
@@ -59,6 +101,12 @@ const ProductMapping = `{
 	  "category_slug" : {
 		"type" : "keyword"
 	  },
+	  "category_path" : {
+		"type" : "keyword"
+	  },
+	  "category_levels" : {
+		"type" : "object"
+	  },
 	  "color" : {
 		  "type" : "text",
 		  "fields" : {
@@ -83,6 +131,15 @@ const ProductMapping = `{
 	  "price" : {
 		"type" : "double"
 	  },
+	  "effective_price" : {
+		"type" : "double"
+	  },
+	  "discount_pct" : {
+		"type" : "double"
+	  },
+	  "created_at" : {
+		"type" : "date"
+	  },
 	  "product_image" : {
 		"type" : "keyword"
 	  },
@@ -93,6 +150,9 @@ const ProductMapping = `{
 		  "type" : "double",
 		  "null_value" : "0.0"
 	  },
+	  "pop_score_log2": {
+		  "type" : "double"
+	  },
 	  "tags" : {
 		"type" : "keyword"
 	  },
@@ -100,7 +160,10 @@ const ProductMapping = `{
 		"type" : "keyword"
 	  },
 	  "status" : {
-		"type" : "keyword"
+		"type" : "boolean"
+	  },
+	  "shop_approved" : {
+		"type" : "boolean"
 	  }
 	}
   }`
@@ -116,6 +179,8 @@ const ShopMapping = `{
 	  },
 	  "shop_name" : {
 		"type" : "text",
+		"analyzer" : "catalog_index",
+		"search_analyzer" : "catalog_search",
 		"fields" : {
 		  "keyword" : {
 			"type" : "keyword"
@@ -163,6 +228,8 @@ const BrandMapping = `{
 	  },
 	  "name" : {
 		"type" : "text",
+		"analyzer" : "catalog_index",
+		"search_analyzer" : "catalog_search",
 		"fields" : {
 		  "keyword" : {
 			"type" : "keyword"
@@ -186,3 +253,43 @@ const BrandMapping = `{
 	  }
 	}
   }`
+
+// CategoryMapping ...
+const CategoryMapping = `{
+	"properties" : {
+	  "id" : {
+		"type" : "integer"
+	  },
+	  "version" : {
+		"type" : "integer"
+	  },
+	  "slug" : {
+		"type" : "keyword"
+	  },
+	  "name" : {
+		"type" : "text",
+		"analyzer" : "catalog_index",
+		"search_analyzer" : "catalog_search",
+		"fields" : {
+		  "keyword" : {
+			"type" : "keyword"
+		  },
+		  "search_as_type": {
+			  "type": "search_as_you_type"
+		  }
+		}
+	  },
+	  "parent_id" : {
+		"type" : "integer"
+	  },
+	  "path" : {
+		"type" : "keyword"
+	  },
+	  "level" : {
+		"type" : "integer"
+	  },
+	  "image_url" : {
+		"type" : "keyword"
+	  }
+	}
+  }`
@@ -0,0 +1,434 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// MigrationIndex is the metadata index recording the applied migrations
+const MigrationIndex = "catalog_migrations"
+
+const migrationMapping = `{
+	"mappings": {
+		"properties": {
+			"version": { "type": "integer" },
+			"description": { "type": "keyword" },
+			"applied_at": { "type": "date" }
+		}
+	}
+}`
+
+// Migration is a numbered, reversible change of the catalog indices
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, es *elasticsearch.Client) error
+	Down        func(ctx context.Context, es *elasticsearch.Client) error
+}
+
+// migrations are applied in order of their versions. Applied migrations are
+// never edited, changes to settings, mappings or aliases go into a new one
+// appended with the next version.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create the catalog indices behind versioned aliases",
+		Up:          ensureIndices,
+		Down:        deleteIndices,
+	},
+	{
+		Version:     2,
+		Description: "reindex products with the spelling suggestion fields",
+		Up:          reindexRepos(RepoNameProduct),
+		Down:        rollbackRepos(RepoNameProduct),
+	},
+	{
+		Version:     3,
+		Description: "map product status as boolean and mirror shop approval into products",
+		Up: func(ctx context.Context, es *elasticsearch.Client) error {
+			if err := Reindex(ctx, es, RepoNameProduct); err != nil {
+				return err
+			}
+			return backfillShopApproval(ctx, es)
+		},
+		Down: rollbackRepos(RepoNameProduct),
+	},
+	{
+		Version:     4,
+		Description: "add the shop and brand versions cascaded into products",
+		Up:          putMappings(RepoNameProduct),
+		// fields can't be removed from a mapping, they are left unused
+		Down: func(ctx context.Context, es *elasticsearch.Client) error { return nil },
+	},
+	{
+		Version:     5,
+		Description: "backfill the category levels of products written before them",
+		Up:          backfillProducts("category_levels", categoryLevelsScript, map[string]interface{}{"separator": categoryPathSeparator}),
+		// products written since carry the levels as well
+		Down: func(ctx context.Context, es *elasticsearch.Client) error { return nil },
+	},
+	{
+		Version:     6,
+		Description: "backfill the effective price of products written before it",
+		Up:          backfillProducts("effective_price", effectivePriceScript, nil),
+		Down:        func(ctx context.Context, es *elasticsearch.Client) error { return nil },
+	},
+	{
+		Version:     7,
+		Description: "backfill the discount of products written before it",
+		Up:          backfillProducts("discount_pct", discountPctScript, nil),
+		Down:        func(ctx context.Context, es *elasticsearch.Client) error { return nil },
+	},
+	{
+		Version:     8,
+		Description: "keep product popularity as its log2",
+		Up: func(ctx context.Context, es *elasticsearch.Client) error {
+			if err := putMappings(RepoNameProduct)(ctx, es); err != nil {
+				return err
+			}
+			return backfillProducts("pop_score_log2", popularityLog2Script, nil)(ctx, es)
+		},
+		// pop_score is left as it was
+		Down: func(ctx context.Context, es *elasticsearch.Client) error { return nil },
+	},
+	{
+		Version:     9,
+		Description: "map the shop and brand ids of products",
+		Up:          putMappings(RepoNameProduct),
+		Down:        func(ctx context.Context, es *elasticsearch.Client) error { return nil },
+	},
+}
+
+// MigrationState is a migration and when it was applied, if it was
+type MigrationState struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// ensureIndices creates the indices and aliases missing and moves indices
+// predating the aliases behind them
+func ensureIndices(ctx context.Context, es *elasticsearch.Client) error {
+	repos, _ := selectRepos(es, nil)
+	for _, r := range repos {
+		err := r.EnsureIndexAndMapping(ctx)
+		if errors.Is(err, errUnaliasedIndex) {
+			err = r.Reindex(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// putMappings puts the current mappings of the named repos, for additions
+// elasticsearch applies to an existing index
+func putMappings(names ...string) func(ctx context.Context, es *elasticsearch.Client) error {
+	return func(ctx context.Context, es *elasticsearch.Client) error {
+		repos, err := selectRepos(es, names)
+		if err != nil {
+			return err
+		}
+		for _, r := range repos {
+			if err := r.EnsureIndexAndMapping(ctx); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// reindexRepos moves the named repos into new index versions, for changes
+// elasticsearch can't apply to an existing index
+func reindexRepos(names ...string) func(ctx context.Context, es *elasticsearch.Client) error {
+	return func(ctx context.Context, es *elasticsearch.Client) error {
+		return Reindex(ctx, es, names...)
+	}
+}
+
+// rollbackRepos moves the named repos back to their previous index versions
+func rollbackRepos(names ...string) func(ctx context.Context, es *elasticsearch.Client) error {
+	return func(ctx context.Context, es *elasticsearch.Client) error {
+		return Rollback(ctx, es, names...)
+	}
+}
+
+// backfillShopApproval sets the shop approval of the products of every
+// approved shop, products of other shops stay hidden
+func backfillShopApproval(ctx context.Context, es *elasticsearch.Client) error {
+	prd := NewProductRepo(es, RepoNameProduct)
+	shp := NewShopRepo(es, RepoNameShop).(*shopRepo)
+
+	return shp.eachApprovedShop(ctx, func(shops []*search.Shop) error {
+		return prd.SetShopApproval(ctx, shops, true)
+	})
+}
+
+// deleteIndices deletes every version of the indices
+func deleteIndices(ctx context.Context, es *elasticsearch.Client) error {
+	idxs := []string{}
+	for _, n := range RepoNames() {
+		idxs = append(idxs, n+"_v*")
+	}
+
+	res, err := es.Indices.Delete(idxs, es.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		log.Println("error deleting indices, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("deleteIndices", res)
+	}
+
+	return nil
+}
+
+// MigrationStatus returns every migration and the applied migrations no longer known
+func MigrationStatus(ctx context.Context, es *elasticsearch.Client) ([]MigrationState, error) {
+	applied, err := appliedMigrations(ctx, es)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrationStates(migrations, applied), nil
+}
+
+// MigrateUp applies the pending migrations up to and including version to,
+// every pending migration when to is 0
+func MigrateUp(ctx context.Context, es *elasticsearch.Client, to int) error {
+	if err := ensureMigrationIndex(ctx, es); err != nil {
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx, es)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range pendingMigrations(migrations, applied, to) {
+		log.Printf("applying migration %d: %s\n", m.Version, m.Description)
+		if err := m.Up(ctx, es); err != nil {
+			return fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		if err := recordMigration(ctx, es, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown reverts the last steps applied migrations, latest first
+func MigrateDown(ctx context.Context, es *elasticsearch.Client, steps int) error {
+	applied, err := appliedMigrations(ctx, es)
+	if err != nil {
+		return err
+	}
+
+	revert, err := revertMigrations(migrations, applied, steps)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range revert {
+		log.Printf("reverting migration %d: %s\n", m.Version, m.Description)
+		if err := m.Down(ctx, es); err != nil {
+			return fmt.Errorf("migration %d: %w", m.Version, err)
+		}
+		if err := forgetMigration(ctx, es, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pendingMigrations returns the migrations not applied up to version to, in order
+func pendingMigrations(ms []Migration, applied map[int]time.Time, to int) []Migration {
+	pending := []Migration{}
+	for _, m := range ms {
+		if to > 0 && m.Version > to {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+
+	return pending
+}
+
+// revertMigrations returns the last steps applied migrations, latest first
+func revertMigrations(ms []Migration, applied map[int]time.Time, steps int) ([]Migration, error) {
+	known := map[int]bool{}
+	for _, m := range ms {
+		known[m.Version] = true
+	}
+	for v := range applied {
+		if !known[v] {
+			return nil, fmt.Errorf("migration %d is applied but unknown, it can't be reverted", v)
+		}
+	}
+
+	revert := []Migration{}
+	for i := len(ms) - 1; i >= 0 && len(revert) < steps; i-- {
+		if _, ok := applied[ms[i].Version]; ok {
+			revert = append(revert, ms[i])
+		}
+	}
+
+	return revert, nil
+}
+
+// migrationStates merges the migrations and when they were applied, ordered by version
+func migrationStates(ms []Migration, applied map[int]time.Time) []MigrationState {
+	states := []MigrationState{}
+	known := map[int]bool{}
+	for _, m := range ms {
+		known[m.Version] = true
+		s := MigrationState{Version: m.Version, Description: m.Description}
+		if at, ok := applied[m.Version]; ok {
+			s.AppliedAt = &at
+		}
+		states = append(states, s)
+	}
+
+	for v, at := range applied {
+		if known[v] {
+			continue
+		}
+		at := at
+		states = append(states, MigrationState{Version: v, Description: "unknown", AppliedAt: &at})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+
+	return states
+}
+
+// ensureMigrationIndex creates the metadata index unless it exists
+func ensureMigrationIndex(ctx context.Context, es *elasticsearch.Client) error {
+	exists, err := indexExists(ctx, es, MigrationIndex)
+	if err != nil || exists {
+		return err
+	}
+
+	res, err := es.Indices.Create(
+		MigrationIndex,
+		es.Indices.Create.WithBody(strings.NewReader(migrationMapping)),
+		es.Indices.Create.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error creating migration index, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("ensureMigrationIndex", res)
+	}
+
+	return nil
+}
+
+// appliedMigrations returns when each applied migration was applied,
+// none when the metadata index doesn't exist yet
+func appliedMigrations(ctx context.Context, es *elasticsearch.Client) (map[int]time.Time, error) {
+	res, err := es.Search(
+		es.Search.WithIndex(MigrationIndex),
+		es.Search.WithSize(10000),
+		es.Search.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error getting applied migrations, error: ", err)
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		return map[int]time.Time{}, nil
+	}
+	if res.IsError() {
+		return nil, decodeErrorResponse("appliedMigrations", res)
+	}
+
+	var r esSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil || r.Hits == nil {
+		return nil, newMalformedResponseError("missing hits")
+	}
+
+	applied := map[int]time.Time{}
+	for _, h := range r.Hits.Hits {
+		var s MigrationState
+		if err := json.Unmarshal(h.Source, &s); err != nil || s.AppliedAt == nil {
+			return nil, newMalformedResponseError("migration %s: %v", h.ID, err)
+		}
+		applied[s.Version] = *s.AppliedAt
+	}
+
+	return applied, nil
+}
+
+// recordMigration records m as applied now
+func recordMigration(ctx context.Context, es *elasticsearch.Client, m Migration) error {
+	now := time.Now().UTC()
+	body, err := json.Marshal(MigrationState{Version: m.Version, Description: m.Description, AppliedAt: &now})
+	if err != nil {
+		return err
+	}
+
+	res, err := es.Index(
+		MigrationIndex,
+		bytes.NewReader(body),
+		es.Index.WithDocumentID(strconv.Itoa(m.Version)),
+		es.Index.WithRefresh("true"),
+		es.Index.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error recording migration, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("recordMigration", res)
+	}
+
+	return nil
+}
+
+// forgetMigration removes the record of m being applied
+func forgetMigration(ctx context.Context, es *elasticsearch.Client, m Migration) error {
+	res, err := es.Delete(
+		MigrationIndex,
+		strconv.Itoa(m.Version),
+		es.Delete.WithRefresh("true"),
+		es.Delete.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error forgetting migration, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() && res.StatusCode != 404 {
+		return decodeErrorResponse("forgetMigration", res)
+	}
+
+	return nil
+}
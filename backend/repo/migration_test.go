@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Migration", func() {
+	ms := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+	at := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	versions := func(ms []Migration) []int {
+		vs := []int{}
+		for _, m := range ms {
+			vs = append(vs, m.Version)
+		}
+		return vs
+	}
+
+	It("numbers the migrations in increasing order", func() {
+		for i := range migrations {
+			Expect(migrations[i].Version).To(Equal(i + 1))
+			Expect(migrations[i].Up).NotTo(BeNil())
+			Expect(migrations[i].Down).NotTo(BeNil())
+		}
+	})
+
+	It("applies the pending migrations up to a version", func() {
+		applied := map[int]time.Time{1: at}
+		Expect(versions(pendingMigrations(ms, applied, 0))).To(Equal([]int{2, 3}))
+		Expect(versions(pendingMigrations(ms, applied, 2))).To(Equal([]int{2}))
+	})
+
+	It("reverts the last applied migrations latest first", func() {
+		applied := map[int]time.Time{1: at, 2: at}
+		revert, err := revertMigrations(ms, applied, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions(revert)).To(Equal([]int{2}))
+
+		revert, err = revertMigrations(ms, applied, 5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(versions(revert)).To(Equal([]int{2, 1}))
+
+		_, err = revertMigrations(ms, map[int]time.Time{4: at}, 1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports applied and pending migrations", func() {
+		states := migrationStates(ms, map[int]time.Time{1: at, 7: at})
+		Expect(states).To(HaveLen(4))
+		Expect(*states[0].AppliedAt).To(Equal(at))
+		Expect(states[1].AppliedAt).To(BeNil())
+		Expect(states[3].Version).To(Equal(7))
+		Expect(states[3].Description).To(Equal("unknown"))
+	})
+})
+
+var _ = Describe("Backfill", func() {
+	var (
+		trnsprt *fakeTransport
+		pr      *productRepo
+	)
+
+	BeforeEach(func() {
+		trnsprt = &fakeTransport{status: http.StatusOK}
+		pr = NewProductRepo(newFakeClient(trnsprt), RepoNameProduct).(*productRepo)
+	})
+
+	It("derives the category levels of the products missing them", func() {
+		trnsprt.response = `{"total": 3, "updated": 3}`
+
+		err := pr.backfill(context.Background(), "category_levels", categoryLevelsScript, map[string]interface{}{"separator": categoryPathSeparator})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trnsprt.path).To(Equal("/" + writeAlias(RepoNameProduct) + "/_update_by_query"))
+		Expect(trnsprt.query).To(ContainSubstring("wait_for_completion=true"))
+		Expect(trnsprt.query).To(ContainSubstring("conflicts=proceed"))
+		Expect(trnsprt.body).To(ContainSubstring(`"must_not":[{"exists":{"field":"category_levels"}}]`))
+		Expect(trnsprt.body).To(ContainSubstring(`String.join(params.separator, path.subList(0, i + 1))`))
+		Expect(trnsprt.body).To(ContainSubstring(`"params":{"separator":`))
+	})
+
+	It("derives the effective price of the products missing it", func() {
+		trnsprt.response = `{"total": 2, "updated": 2}`
+
+		Expect(pr.backfill(context.Background(), "effective_price", effectivePriceScript, nil)).To(Succeed())
+		Expect(trnsprt.body).To(ContainSubstring(`"must_not":[{"exists":{"field":"effective_price"}}]`))
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.effective_price = d;`))
+		Expect(trnsprt.body).NotTo(ContainSubstring(`"params"`))
+	})
+
+	It("derives the discount of the products missing it", func() {
+		trnsprt.response = `{"total": 2, "updated": 2}`
+
+		Expect(pr.backfill(context.Background(), "discount_pct", discountPctScript, nil)).To(Succeed())
+		Expect(trnsprt.body).To(ContainSubstring(`"must_not":[{"exists":{"field":"discount_pct"}}]`))
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.discount_pct = (p - d) * 100.0 / p;`))
+	})
+
+	It("converts the linear popularity of products to log2", func() {
+		trnsprt.response = `{"total": 2, "updated": 1, "noops": 1}`
+
+		Expect(pr.backfill(context.Background(), "pop_score_log2", popularityLog2Script, nil)).To(Succeed())
+		Expect(trnsprt.body).To(ContainSubstring(`"must_not":[{"exists":{"field":"pop_score_log2"}}]`))
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.pop_score_log2 = Math.log(p) / Math.log(2);`))
+	})
+
+	It("fails on an error response", func() {
+		trnsprt.status = http.StatusBadRequest
+		trnsprt.response = `{"error": {"type": "script_exception", "reason": "compile error"}, "status": 400}`
+
+		Expect(pr.backfill(context.Background(), "category_levels", categoryLevelsScript, nil)).NotTo(Succeed())
+	})
+})
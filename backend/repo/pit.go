@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/infra"
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// pitKeepAlive is how long a point in time outlives the page that used it last
+const pitKeepAlive = "1m"
+
+// cursor is the position a cursor page ended at, it is handed to clients
+// base64 encoded so they treat it as opaque
+type cursor struct {
+	PitID string            `json:"pit"`
+	After []json.RawMessage `json:"after"`
+}
+
+func encodeCursor(c cursor) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes a cursor handed out by encodeCursor, the empty
+// cursor starts at the first page
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	if s == "" {
+		return c, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, search.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.PitID == "" || len(c.After) == 0 {
+		return c, search.ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// isContextMissing reports whether err is elasticsearch rejecting an
+// expired or unknown point in time
+func isContextMissing(err error) bool {
+	var esErr *infra.ESResponseError
+	if !errors.As(err, &esErr) {
+		return false
+	}
+
+	return strings.Contains(fmt.Sprint(esErr.Details), "search_context_missing_exception")
+}
+
+// openPIT opens a point in time of the index, the snapshot every page of a
+// cursor pagination is read from
+func (ir *indexRepo[T]) openPIT(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("/%s/_pit?keep_alive=%s", ir.index, pitKeepAlive), nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := ir.client.Perform(req)
+	if err != nil {
+		log.Printf("%s: Error opening point in time: %s\n", ir.op("openPIT"), err)
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode > 299 {
+		return "", newMalformedResponseError("opening point in time returned status %d", res.StatusCode)
+	}
+
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil || r.ID == "" {
+		return "", newMalformedResponseError("missing point in time id")
+	}
+
+	return r.ID, nil
+}
+
+// closePIT releases a point in time, failures are only logged as the
+// point in time expires anyway
+func (ir *indexRepo[T]) closePIT(ctx context.Context, id string) {
+	body, _ := json.Marshal(map[string]string{"id": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, "/_pit", strings.NewReader(string(body)))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := ir.client.Perform(req)
+	if err != nil {
+		log.Printf("%s: Error closing point in time: %s\n", ir.op("closePIT"), err)
+		return
+	}
+	res.Body.Close()
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// effectivePrice is the discounted price of a discounted product and the
+// price otherwise
+func effectivePrice(p *search.Product) float64 {
+	if p.DiscountedPrice > 0 {
+		return p.DiscountedPrice
+	}
+
+	return p.Price
+}
+
+// discountPct is the discount off the price of p in percent
+func discountPct(p *search.Product) float64 {
+	if p.Price <= 0 || p.DiscountedPrice <= 0 || p.DiscountedPrice >= p.Price {
+		return 0
+	}
+
+	return (p.Price - p.DiscountedPrice) / p.Price * 100
+}
+
+// priceFilter matches the products whose effective price is within min and max
+func priceFilter(min *float64, max *float64) map[string]interface{} {
+	if min == nil && max == nil {
+		return map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		}
+	}
+
+	rng := map[string]interface{}{}
+	if min != nil {
+		rng["gte"] = *min
+	}
+	if max != nil {
+		rng["lte"] = *max
+	}
+
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			"effective_price": rng,
+		},
+	}
+}
+
+// priceRanges returns a range per pair of adjacent bounds, the last range
+// has no upper bound
+func priceRanges(bounds []float64) []map[string]interface{} {
+	rngs := make([]map[string]interface{}, 0, len(bounds))
+	for i, b := range bounds {
+		rng := map[string]interface{}{"from": b}
+		if i+1 < len(bounds) {
+			rng["to"] = bounds[i+1]
+		}
+		rngs = append(rngs, rng)
+	}
+
+	return rngs
+}
+
+// priceAgg returns the price statistics and buckets of req, counted over
+// the documents matching filters
+func priceAgg(filters []map[string]interface{}, req search.FacetSearchReq) map[string]interface{} {
+	aggs := map[string]interface{}{
+		"prices_stats": map[string]interface{}{
+			"stats": map[string]interface{}{
+				"field": "effective_price",
+			},
+		},
+	}
+
+	switch {
+	case req.PriceInterval > 0:
+		aggs["prices_histogram"] = map[string]interface{}{
+			"histogram": map[string]interface{}{
+				"field":         "effective_price",
+				"interval":      req.PriceInterval,
+				"min_doc_count": 1,
+			},
+		}
+	case len(req.PriceRanges) > 0:
+		aggs["prices_ranges"] = map[string]interface{}{
+			"range": map[string]interface{}{
+				"field":  "effective_price",
+				"ranges": priceRanges(req.PriceRanges),
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"filter": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
+			},
+		},
+		"aggs": aggs,
+	}
+}
+
+// priceFacet decodes the aggregation built by priceAgg
+func priceFacet(r *esSearchResponse, req search.FacetSearchReq) (*search.PriceFacet, error) {
+	var stats esStatsAgg
+	if err := r.aggregation(&stats, "prices", "prices_stats"); err != nil {
+		return nil, err
+	}
+
+	fct := &search.PriceFacet{Buckets: []search.PriceBucket{}}
+	if stats.Min != nil && stats.Max != nil {
+		fct.Min, fct.Max = *stats.Min, *stats.Max
+	}
+
+	switch {
+	case req.PriceInterval > 0:
+		var hist esHistogramAgg
+		if err := r.aggregation(&hist, "prices", "prices_histogram"); err != nil {
+			return nil, err
+		}
+		for _, b := range hist.Buckets {
+			from, to := b.Key, b.Key+req.PriceInterval
+			fct.Buckets = append(fct.Buckets, search.PriceBucket{From: &from, To: &to, DocCount: b.DocCount})
+		}
+	case len(req.PriceRanges) > 0:
+		var rngs esRangeAgg
+		if err := r.aggregation(&rngs, "prices", "prices_ranges"); err != nil {
+			return nil, err
+		}
+		for _, b := range rngs.Buckets {
+			fct.Buckets = append(fct.Buckets, search.PriceBucket{From: b.From, To: b.To, DocCount: b.DocCount})
+		}
+	}
+
+	return fct, nil
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Price", func() {
+	It("prefers the discounted price", func() {
+		Expect(effectivePrice(&search.Product{Price: 100, DiscountedPrice: 80})).To(Equal(80.0))
+		Expect(effectivePrice(&search.Product{Price: 100})).To(Equal(100.0))
+	})
+
+	It("leaves the last range unbounded", func() {
+		Expect(priceRanges([]float64{0, 500})).To(Equal([]map[string]interface{}{
+			{"from": 0.0, "to": 500.0},
+			{"from": 500.0},
+		}))
+	})
+
+	It("decodes min, max and range buckets", func() {
+		body := `{
+			"hits": {"total": {"value": 3}, "hits": []},
+			"aggregations": {
+				"prices": {
+					"doc_count": 3,
+					"prices_stats": {"count": 3, "min": 120, "max": 900, "avg": 400, "sum": 1200},
+					"prices_ranges": {"buckets": [
+						{"key": "0.0-500.0", "from": 0, "to": 500, "doc_count": 2},
+						{"key": "500.0-*", "from": 500, "doc_count": 1}
+					]}
+				}
+			}
+		}`
+		r, err := decodeSearchResponse(strings.NewReader(body))
+		Expect(err).ToNot(HaveOccurred())
+
+		fct, err := priceFacet(r, search.FacetSearchReq{PriceRanges: []float64{0, 500}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fct.Min).To(Equal(120.0))
+		Expect(fct.Max).To(Equal(900.0))
+		Expect(fct.Buckets).To(HaveLen(2))
+		Expect(*fct.Buckets[0].To).To(Equal(500.0))
+		Expect(fct.Buckets[1].To).To(BeNil())
+		Expect(fct.Buckets[1].DocCount).To(Equal(int64(1)))
+	})
+})
@@ -6,422 +6,252 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
+	"sort"
+	"strconv"
+	"sync/atomic"
 
-	"github.com/BackAged/go-elasticsearch-react/backend/infra"
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
 	"github.com/BackAged/go-elasticsearch-react/backend/search"
 	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
-	"github.com/elastic/go-elasticsearch/v7/esutil"
-	"github.com/mitchellh/mapstructure"
 )
 
+// productDocument is the indexed form of a product
+type productDocument struct {
+	*search.Product
+	// CategoryLevels holds the category path down to every depth, it
+	// backs category drill down
+	CategoryLevels map[string]string `json:"category_levels"`
+	// EffectivePrice is the price a customer pays, it backs price
+	// filtering and the price facet
+	EffectivePrice float64 `json:"effective_price"`
+	// DiscountPct is the discount off the price in percent, it backs
+	// sorting by discount
+	DiscountPct float64 `json:"discount_pct"`
+}
+
 type productRepo struct {
-	index  string
-	client *elasticsearch.Client
+	*indexRepo[search.Product]
+	// fts holds the []config.RankFeature relevance is boosted by
+	fts atomic.Value
 }
 
 // ProductRepo ...
 type ProductRepo interface {
 	search.ProductRepo
+	search.PopularityRepo
 	Repo
+	SetRankFeatures(fts []config.RankFeature)
+	suggestGroup(req search.SuggestReq, size int, dst *[]*search.Highlighted[search.Product]) msearchGroup
 }
 
 // NewProductRepo returns a new productRepo
 func NewProductRepo(client *elasticsearch.Client, index string) ProductRepo {
 	return &productRepo{
-		client: client,
-		index:  index,
-	}
-}
-
-func (pr *productRepo) EnsureMapping() error {
-	log.Println("creating mappings for ", pr.index)
-	res, err := pr.client.Indices.PutMapping(strings.NewReader(ProductMapping), pr.client.Indices.PutMapping.WithIndex(pr.index))
-
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Printf("productRepo.EnsureIndexMapping: Error decoding error response: %s\n", err)
-		} else {
-			log.Printf("productRepo.EnsureIndexMapping: Error response [%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
-		}
-		log.Println("couldn't create mappings for ", pr.index, "error: ", e)
-		return err
-	}
-
-	return nil
-}
-
-func (pr *productRepo) EnsureIndex() error {
-	res, err := pr.client.Indices.Get([]string{pr.index})
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-
-	if res.IsError() {
-		log.Println("creating new index ", pr.index)
-		indexCreateResponse, err := pr.client.Indices.Create(pr.index)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		if indexCreateResponse.IsError() {
-			var e map[string]interface{}
-			if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-				log.Printf("productRepo.EnsureIndexMapping: Error decoding error response: %s\n", err)
-			} else {
-				log.Printf("productRepo.EnsureIndexMapping: Error response [%s] %s: %s",
-					res.Status(),
-					e["error"].(map[string]interface{})["type"],
-					e["error"].(map[string]interface{})["reason"],
-				)
-			}
-			log.Println("couldn't create index ", pr.index, "error: ", e)
-			return err
-		}
-	}
-
-	return nil
-}
-
-func (pr *productRepo) EnsureIndexAndMapping() error {
-	if err := pr.EnsureIndex(); err != nil {
-		return err
+		indexRepo: newIndexRepo(client, index, indexSpec[search.Product]{
+			name:     "productRepo",
+			mapping:  ProductMapping,
+			settings: IndexSettings,
+			docID: func(p *search.Product) int64 {
+				return p.ShopItemID
+			},
+			document: func(p *search.Product) interface{} {
+				return &productDocument{
+					Product:        p,
+					CategoryLevels: categoryLevels(p.CategoryPath),
+					EffectivePrice: effectivePrice(p),
+					DiscountPct:    discountPct(p),
+				}
+			},
+			searchFields: []string{
+				"name",
+				"shop_name",
+				"category_name",
+				"brand_name",
+			},
+			highlightFields: []string{
+				"name",
+				"shop_name",
+				"category_name",
+				"brand_name",
+			},
+			visibility: []map[string]interface{}{
+				{"term": map[string]interface{}{"status": true}},
+				{"term": map[string]interface{}{"shop_approved": true}},
+			},
+			tieBreaker: "shop_item_id",
+		}),
 	}
-
-	return pr.EnsureMapping()
 }
 
-func (pr *productRepo) BulkInsert(ctx context.Context, products []*search.Product) ([]*search.Product, error) {
-	var buf bytes.Buffer
-	for _, prd := range products {
-		jPrd, _ := json.Marshal(prd)
-		jPrd = append(jPrd, "\n"...)
-		meta := []byte(fmt.Sprintf(`{ "index" : { "_id" : "%d" } }%s`, prd.ShopItemID, "\n"))
-		buf.Grow(len(meta) + len(jPrd))
-		buf.Write(meta)
-		buf.Write(jPrd)
-	}
-
-	req := esapi.BulkRequest{
-		Index:   pr.index,
-		Refresh: "true",
-		Body:    bytes.NewReader(buf.Bytes()),
-	}
-
-	res, err := req.Do(context.Background(), pr.client)
+func (pr *productRepo) Add(ctx context.Context, product *search.Product) (*search.Product, error) {
+	j, err := pr.document(product)
 	if err != nil {
-		log.Printf("productRepo.BulkInsert: Error sending query: %s\n", err)
+		log.Printf("productRepo.Add: Error encoding document: %s\n", err)
 		return nil, err
 	}
-	defer res.Body.Close()
-
-	fmt.Println(res.String())
-	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Printf("productRepo.BulkInsert: Error decoding error response: %s\n", err)
-		} else {
-			log.Printf("productRepo.BulkInsert: Error response [%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
-		}
-
-		return nil, infra.NewESResponseError("query returned error", e)
-	}
-
-	// Deserialize the response into a map.
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		log.Printf("productRepo.BulkInsert: Error decoding success response: %s\n", err)
-	} else {
-		// Print the response status and indexed document version.
-		log.Printf("[%s] %s; ", res.Status(), r["result"])
-	}
-
-	return nil, err
-}
-
-func (pr *productRepo) Add(ctx context.Context, product *search.Product) (*search.Product, error) {
-	fmt.Println(product)
-	fmt.Println(esutil.NewJSONReader(product))
-	j, _ := json.Marshal(product)
 	req := esapi.IndexRequest{
-		Index:   pr.index,
-		Body:    strings.NewReader(string(j)),
-		Refresh: "true",
+		Index:      pr.writeIndex,
+		DocumentID: fmt.Sprintf("%d", pr.spec.docID(product)),
+		Body:       bytes.NewReader(j),
 	}
 
-	res, err := req.Do(context.Background(), pr.client)
+	res, err := req.Do(ctx, pr.client)
 	if err != nil {
-		log.Fatalf("Error getting response: %s", err)
+		log.Printf("productRepo.Add: Error sending query: %s\n", err)
 		return nil, err
 	}
 	defer res.Body.Close()
 
-	fmt.Println(res.String())
 	if res.IsError() {
-		log.Printf("[%s] Error indexing document", res.Status())
-		return nil, err
+		return nil, decodeErrorResponse("productRepo.Add", res)
 	}
 
-	// Deserialize the response into a map.
-	var r map[string]interface{}
+	var r esIndexResponse
 	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
 		log.Printf("Error parsing the response body: %s", err)
-	} else {
-		// Print the response status and indexed document version.
-		log.Printf("[%s] %s; version=%d", res.Status(), r["result"], int(r["_version"].(float64)))
+		return nil, newMalformedResponseError("%s", err)
 	}
+	log.Printf("[%s] %s; version=%d", res.Status(), r.Result, r.Version)
 
-	return nil, err
+	return product, nil
 }
 
-func (pr *productRepo) Search(ctx context.Context, term string, skip int64, limit int64) ([]*search.Product, int64, error) {
-	var buf bytes.Buffer
+func (pr *productRepo) Search(ctx context.Context, term string, page search.Page) ([]*search.Highlighted[search.Product], search.PageInfo, error) {
 	query := map[string]interface{}{
-		"from": skip,
-		"size": limit,
 		"query": map[string]interface{}{
 			"multi_match": map[string]interface{}{
-				"query": term,
-				"type":  "bool_prefix",
-				"fields": []string{
-					"name",
-					"shop_name",
-					"category_name",
-					"brand_name",
-				},
-				//"type": "most_fields",
+				"query":  term,
+				"type":   "bool_prefix",
+				"fields": pr.spec.searchFields,
 			},
 		},
-		"sort": []map[string]interface{}{
-			{
-				"_score": map[string]interface{}{
-					"order": "desc",
-				},
-				"pop_score": map[string]interface{}{
-					"order": "desc",
-				},
-			},
-		},
-	}
-	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		log.Printf("productRepo.Search: Error encoding query: %s\n", err)
-		return nil, 0, err
+		"sort": sortClauses[search.SortRelevance],
 	}
+	applyRanking(query, pr.rankFeatures())
 
-	// Perform the search request.
-	res, err := pr.client.Search(
-		pr.client.Search.WithContext(context.Background()),
-		pr.client.Search.WithIndex(pr.index),
-		pr.client.Search.WithBody(&buf),
-		pr.client.Search.WithTrackTotalHits(true),
-		pr.client.Search.WithPretty(),
-	)
+	r, info, err := pr.searchPage(ctx, "productRepo.Search", query, page)
 	if err != nil {
-		log.Printf("productRepo.Search: Error sending query to server: %s\n", err)
-		return nil, 0, err
-	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Printf("productRepo.Search: Error decoding error response: %s\n", err)
-		} else {
-			log.Printf("productRepo.Search: Error response [%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
-		}
-
-		return nil, 0, infra.NewESResponseError("query returned error", e)
-	}
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		log.Printf("productRepo.Search: Error decoding success response: %s\n", err)
-		return nil, 0, err
-	}
-
-	total := int64(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-	timeTaken := int64(r["took"].(float64))
-	log.Printf(
-		"[%s] %d hits; took: %dms\n",
-		res.Status(),
-		total,
-		timeTaken,
-	)
-
-	prds := []*search.Product{}
-	for _, hit := range r["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		var b search.Product
-		if err := mapstructure.Decode(hit.(map[string]interface{})["_source"], &b); err != nil {
-			log.Printf("productRepo.Search: Error decoding response: %s\n", err)
-			return nil, 0, err
-		}
-		prds = append(prds, &b)
+		return nil, search.PageInfo{}, err
 	}
 
-	return prds, total, nil
-
-}
-
-func (pr *productRepo) UpdateMany(ctx context.Context, products []*search.Product) ([]*search.Product, error) {
-	var buf bytes.Buffer
-	for _, prd := range products {
-		jBrnd, _ := json.Marshal(prd)
-		jiBrnd := string(jBrnd)
-		meta := []byte(fmt.Sprintf(`{ "update" : { "_id" : "%d" } }%s`, prd.ShopItemID, "\n")) //"retry_on_conflict" : 5
-		buf.Grow(len(meta) + len(jBrnd))
-		buf.Write(meta)
-		doc := getConcurrencyControlledUpdateQuery(jBrnd, jiBrnd)
-		buf.Write(doc)
-		fmt.Println(buf.String())
-	}
-
-	req := esapi.BulkRequest{
-		Index:   pr.index,
-		Refresh: "true",
-		Body:    bytes.NewReader(buf.Bytes()),
-	}
-
-	res, err := req.Do(context.Background(), pr.client)
+	prds, err := pr.hits("productRepo.Search", r.Hits.Hits)
 	if err != nil {
-		log.Printf("productRepo.UpdateMany: Error sending query: %s\n", err)
-		return nil, err
+		return nil, search.PageInfo{}, err
 	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Printf("productRepo.UpdateMany: Error decoding error response: %s\n", err)
-		} else {
-			log.Printf("productRepo.UpdateMany: Error response [%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
-		}
 
-		return nil, infra.NewESResponseError("query returned error", e)
-	}
+	return prds, info, nil
+}
 
-	// Deserialize the response into a map.
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		log.Printf("productRepo.UpdateMany: Error decoding success response: %s\n", err)
-	} else {
-		log.Printf("[%s] %s; ", res.Status(), r["result"])
-	}
+// suggestGroup ranks product suggestions like Search does
+func (pr *productRepo) suggestGroup(req search.SuggestReq, size int, dst *[]*search.Highlighted[search.Product]) msearchGroup {
+	g := pr.indexRepo.suggestGroup(req, size, dst)
+	g.query["sort"] = sortClauses[search.SortRelevance]
+	applyRanking(g.query, pr.rankFeatures())
 
-	return nil, err
+	return g
 }
 
-func (pr *productRepo) DeleteMany(ctx context.Context, shopItemIDS []int64) error {
-	var buf bytes.Buffer
-	for _, id := range shopItemIDS {
-		meta := []byte(fmt.Sprintf(`{ "delete" : { "_id" : "%d" } }%s`, id, "\n"))
-		buf.Grow(len(meta))
-		buf.Write(meta)
+// SetShopApproval sets the shop approval of every product of the shops,
+// products already holding it are left untouched. Products are matched by
+// shop id, products written without one by shop slug, like cascades do.
+func (pr *productRepo) SetShopApproval(ctx context.Context, shops []*search.Shop, approved bool) error {
+	ids := make([]int64, 0, len(shops))
+	slugs := make([]string, 0, len(shops))
+	for _, s := range shops {
+		ids = append(ids, s.ID)
+		slugs = append(slugs, s.Slug)
 	}
 
-	req := esapi.BulkRequest{
-		Index:   pr.index,
-		Refresh: "true",
-		Body:    bytes.NewReader(buf.Bytes()),
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []map[string]interface{}{{
+					"bool": map[string]interface{}{
+						"should": []map[string]interface{}{
+							{"terms": map[string]interface{}{"shop_id": ids}},
+							{"bool": map[string]interface{}{
+								"filter":   []map[string]interface{}{{"terms": map[string]interface{}{"shop_slug": slugs}}},
+								"must_not": []map[string]interface{}{{"exists": map[string]interface{}{"field": "shop_id"}}},
+							}},
+						},
+						"minimum_should_match": 1,
+					},
+				}},
+				"must_not": []map[string]interface{}{
+					{"term": map[string]interface{}{"shop_approved": approved}},
+				},
+			},
+		},
+		"script": map[string]interface{}{
+			"source": "ctx._source.shop_approved = params.approved",
+			"lang":   "painless",
+			"params": map[string]interface{}{"approved": approved},
+		},
+	})
+	if err != nil {
+		return err
 	}
 
-	res, err := req.Do(context.Background(), pr.client)
+	res, err := pr.client.UpdateByQuery(
+		[]string{pr.writeIndex},
+		pr.client.UpdateByQuery.WithBody(bytes.NewReader(body)),
+		pr.client.UpdateByQuery.WithConflicts("proceed"),
+		pr.client.UpdateByQuery.WithWaitForCompletion(true),
+		pr.client.UpdateByQuery.WithContext(ctx),
+	)
 	if err != nil {
-		log.Printf("brandRepo.DeleteMany: Error sending query: %s\n", err)
+		log.Printf("productRepo.SetShopApproval: Error getting response: %s\n", err)
 		return err
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Printf("productRepo.DeleteMany: Error decoding error response: %s\n", err)
-		} else {
-			log.Printf("productRepo.DeleteMany: Error response [%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
-		}
-
-		return infra.NewESResponseError("query returned error", e)
+		return decodeErrorResponse("productRepo.SetShopApproval", res)
 	}
 
-	// Deserialize the response into a map.
-	// var r map[string]interface{}
-	// if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-	// 	log.Printf("productRepo.BulkInsert: Error decoding success response: %s\n", err)
-	// } else {
-	// 	log.Printf("[%s] %s; ", res.Status(), r["result"])
-	// }
-
 	return nil
 }
 
-func (pr *productRepo) UpdateProductScore(ctx context.Context, shopItemID int64) error {
-	var buf bytes.Buffer
-	query := map[string]interface{}{
-		"script": map[string]interface{}{
-			"source": "if(ctx._source.pop_score==null){ctx._source.pop_score=0.0001} else {ctx._source.pop_score+=0.0001}",
-			"lang":   "painless",
-		},
-	}
-	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		log.Printf("productRepo.UpdateProductScore: Error encoding query: %s\n", err)
-		return err
+// SetRankFeatures replaces the rank features searches are boosted by, it is
+// safe to call while searching
+func (pr *productRepo) SetRankFeatures(fts []config.RankFeature) {
+	pr.fts.Store(fts)
+}
+
+func (pr *productRepo) rankFeatures() []config.RankFeature {
+	fts, _ := pr.fts.Load().([]config.RankFeature)
+	return fts
+}
+
+// popularityScript adds the log2 popularity params.score to the log2
+// popularity of a product, like search.AddLog2 does
+const popularityScript = "double s = params.score; if (ctx._source.pop_score_log2 == null) {ctx._source.pop_score_log2 = s} else {double c = ctx._source.pop_score_log2; double m = Math.max(c, s); ctx._source.pop_score_log2 = m + Math.log(1 + Math.pow(2, Math.min(c, s) - m)) / Math.log(2)}"
+
+// AddPopularity adds log2 popularity scores to the pop_score_log2 of the
+// products, keyed by shop item id
+func (pr *productRepo) AddPopularity(ctx context.Context, scores map[int64]float64) (*search.BulkResult, error) {
+	ids := make([]int64, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
 	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
 
-	// Perform the update by query request.
-	res, err := pr.client.Update(
-		pr.index, fmt.Sprintf("%d", shopItemID), &buf,
-		pr.client.Update.WithContext(context.Background()),
-		pr.client.Update.WithRetryOnConflict(5),
-	)
+	src, err := json.Marshal(popularityScript)
 	if err != nil {
-		log.Printf("productRepo.UpdateProductScore: Error sending query: %s\n", err)
-		return err
+		return nil, err
 	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Printf("productRepo.UpdateProductScore: Error decoding error response: %s\n", err)
-		} else {
-			log.Printf("productRepo.UpdateProductScore: Error response [%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
-		}
 
-		return infra.NewESResponseError("query returned error", e)
+	var buf bytes.Buffer
+	for _, id := range ids {
+		meta := []byte(fmt.Sprintf(`{ "update" : { "_id" : "%d", "retry_on_conflict" : 3 } }%s`, id, "\n"))
+		body := []byte(fmt.Sprintf(`{"script": {"source": %s, "lang": "painless", "params": {"score": %s}}}%s`, src, strconv.FormatFloat(scores[id], 'g', -1, 64), "\n"))
+		buf.Grow(len(meta) + len(body))
+		buf.Write(meta)
+		buf.Write(body)
 	}
 
-	return nil
+	return pr.bulk(ctx, "productRepo.AddPopularity", buf.Bytes())
 }
 
 func boolTermIndividual(name string, vals []string) map[string]interface{} {
@@ -444,13 +274,42 @@ func boolTermIndividual(name string, vals []string) map[string]interface{} {
 	return s
 }
 
-func applyPostFilter(query map[string]interface{}, req search.FacetSearchReq) map[string]interface{} {
+// facetFilter is the filter a facet selection applies to the search
+type facetFilter struct {
+	facet  string
+	filter map[string]interface{}
+}
+
+// facetFilters returns the filters of every facet selection of req
+func facetFilters(req search.FacetSearchReq) []facetFilter {
+	return []facetFilter{
+		{facet: "categories", filter: boolTermIndividual("category_name.keyword", req.CategoryFilters)},
+		{facet: "categories", filter: categoryPathFilter(req.CategoryPath)},
+		{facet: "shops", filter: boolTermIndividual("shop_name.keyword", req.ShopFilters)},
+		{facet: "brands", filter: boolTermIndividual("brand_name.keyword", req.BrandFilters)},
+		{facet: "colors", filter: boolTermIndividual("color.keyword", req.ColorFilters)},
+		{facet: "prices", filter: priceFilter(req.MinPrice, req.MaxPrice)},
+	}
+}
+
+// filtersExcept returns the filters of every facet but facet, so a facet
+// counts documents as if its own selection was not applied
+func filtersExcept(fltrs []facetFilter, facet string) []map[string]interface{} {
 	ss := []map[string]interface{}{}
+	for _, f := range fltrs {
+		if f.facet != facet {
+			ss = append(ss, f.filter)
+		}
+	}
 
-	ss = append(ss, boolTermIndividual("category_name.keyword", req.CategoryFilters))
-	ss = append(ss, boolTermIndividual("shop_name.keyword", req.ShopFilters))
-	ss = append(ss, boolTermIndividual("brand_name.keyword", req.BrandFilters))
-	ss = append(ss, boolTermIndividual("color.keyword", req.ColorFilters))
+	return ss
+}
+
+func applyPostFilter(query map[string]interface{}, req search.FacetSearchReq) map[string]interface{} {
+	ss := []map[string]interface{}{}
+	for _, f := range facetFilters(req) {
+		ss = append(ss, f.filter)
+	}
 
 	query["post_filter"] = map[string]interface{}{
 		"bool": map[string]interface{}{
@@ -461,115 +320,84 @@ func applyPostFilter(query map[string]interface{}, req search.FacetSearchReq) ma
 	return query
 }
 
-func applySort(query map[string]interface{}, req search.FacetSearchReq) map[string]interface{} {
-	arg := []map[string]interface{}{}
-	for _, sort := range req.Sort {
-		s := map[string]interface{}{
-			sort.FieldName: map[string]interface{}{
-				"order": sort.Order,
-			},
-		}
-		arg = append(arg, s)
-	}
-	arg = append(arg, map[string]interface{}{
-		"_score": map[string]interface{}{
-			"order": "desc",
-		},
-		"pop_score": map[string]interface{}{
-			"order": "desc",
+func sortBy(field string, order string) map[string]interface{} {
+	return map[string]interface{}{
+		field: map[string]interface{}{
+			"order": order,
 		},
-	})
-
-	query["sort"] = arg
+	}
+}
 
-	return query
+// sortClauses maps every sort mode to the sort of the query, ties are
+// broken by relevance and popularity
+var sortClauses = map[search.SortMode][]map[string]interface{}{
+	search.SortRelevance: {sortBy("_score", "desc"), sortBy("pop_score_log2", "desc")},
+	search.SortPriceAsc:  {sortBy("effective_price", "asc"), sortBy("_score", "desc"), sortBy("pop_score_log2", "desc")},
+	search.SortPriceDesc: {sortBy("effective_price", "desc"), sortBy("_score", "desc"), sortBy("pop_score_log2", "desc")},
+	search.SortNewest:    {sortBy("created_at", "desc"), sortBy("_score", "desc"), sortBy("pop_score_log2", "desc")},
+	search.SortPopular:   {sortBy("pop_score_log2", "desc"), sortBy("_score", "desc")},
+	search.SortDiscount:  {sortBy("discount_pct", "desc"), sortBy("_score", "desc"), sortBy("pop_score_log2", "desc")},
 }
 
-func applyFacet(query map[string]interface{}, req search.FacetSearchReq) map[string]interface{} {
-	ss := []map[string]interface{}{}
+// applySort sorts by the sort mode of req, unknown modes sort by relevance
+func applySort(query map[string]interface{}, req search.FacetSearchReq) map[string]interface{} {
+	srt, ok := sortClauses[req.Sort]
+	if !ok {
+		srt = sortClauses[search.SortRelevance]
+	}
 
-	ca := boolTermIndividual("category_name.keyword", req.CategoryFilters)
-	s := boolTermIndividual("shop_name.keyword", req.ShopFilters)
-	b := boolTermIndividual("brand_name.keyword", req.BrandFilters)
-	c := boolTermIndividual("color.keyword", req.ColorFilters)
+	query["sort"] = srt
 
-	cat := append(append(append(append(ss, s), b)), c)
-	shp := append(append(append(append(ss, ca), b)), c)
-	brnd := append(append(append(append(ss, ca), s)), c)
-	clr := append(append(append(append(ss, ca), s)), b)
+	return query
+}
 
-	query["aggs"] = map[string]interface{}{
-		"categories": map[string]interface{}{
-			"filter": map[string]interface{}{
-				"bool": map[string]interface{}{
-					"filter": cat,
-				},
-			},
-			"aggs": map[string]interface{}{
-				"categories_filtered": map[string]interface{}{
-					"terms": map[string]interface{}{
-						"field": "category_name.keyword",
-						"size":  req.BucketSize,
-					},
-				},
+// facetAgg returns the terms aggregation name, counted over the documents
+// matching filters
+func facetAgg(name string, filters []map[string]interface{}, terms map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"filter": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": filters,
 			},
 		},
-		"shops": map[string]interface{}{
-			"filter": map[string]interface{}{
-				"bool": map[string]interface{}{
-					"filter": shp,
-				},
-			},
-			"aggs": map[string]interface{}{
-				"shops_filtered": map[string]interface{}{
-					"terms": map[string]interface{}{
-						"field": "shop_name.keyword",
-						"size":  req.BucketSize,
-					},
-				},
-			},
-		},
-		"brands": map[string]interface{}{
-			"filter": map[string]interface{}{
-				"bool": map[string]interface{}{
-					"filter": brnd,
-				},
-			},
-			"aggs": map[string]interface{}{
-				"brands_filtered": map[string]interface{}{
-					"terms": map[string]interface{}{
-						"field": "brand_name.keyword",
-						"size":  req.BucketSize,
-					},
-				},
-			},
-		},
-		"colors": map[string]interface{}{
-			"filter": map[string]interface{}{
-				"bool": map[string]interface{}{
-					"filter": clr,
-				},
-			},
-			"aggs": map[string]interface{}{
-				"color_filtered": map[string]interface{}{
-					"terms": map[string]interface{}{
-						"field":   "color.keyword",
-						"size":    req.BucketSize,
-						"exclude": []string{""},
-					},
-				},
+		"aggs": map[string]interface{}{
+			name: map[string]interface{}{
+				"terms": terms,
 			},
 		},
 	}
+}
+
+func applyFacet(query map[string]interface{}, req search.FacetSearchReq) map[string]interface{} {
+	fltrs := facetFilters(req)
+
+	query["aggs"] = map[string]interface{}{
+		"categories": facetAgg("categories_filtered", filtersExcept(fltrs, "categories"), map[string]interface{}{
+			"field": "category_name.keyword",
+			"size":  req.BucketSize,
+		}),
+		"category_tree": categoryTreeAgg(filtersExcept(fltrs, "categories"), req.CategoryPath, req.BucketSize),
+		"shops": facetAgg("shops_filtered", filtersExcept(fltrs, "shops"), map[string]interface{}{
+			"field": "shop_name.keyword",
+			"size":  req.BucketSize,
+		}),
+		"brands": facetAgg("brands_filtered", filtersExcept(fltrs, "brands"), map[string]interface{}{
+			"field": "brand_name.keyword",
+			"size":  req.BucketSize,
+		}),
+		"colors": facetAgg("color_filtered", filtersExcept(fltrs, "colors"), map[string]interface{}{
+			"field":   "color.keyword",
+			"size":    req.BucketSize,
+			"exclude": []string{""},
+		}),
+		"prices": priceAgg(filtersExcept(fltrs, "prices"), req),
+	}
 
 	return query
 }
 
-func (pr *productRepo) SearchFacet(ctx context.Context, req search.FacetSearchReq) ([]*search.Product, *search.FacetRes, int64, error) {
-	var buf bytes.Buffer
+func (pr *productRepo) SearchFacet(ctx context.Context, req search.FacetSearchReq) (*search.FacetSearchRes, search.PageInfo, error) {
 	query := map[string]interface{}{
-		"from": req.From,
-		"size": req.Size,
 		"query": map[string]interface{}{
 			"multi_match": map[string]interface{}{
 				"query": req.Term,
@@ -591,121 +419,67 @@ func (pr *productRepo) SearchFacet(ctx context.Context, req search.FacetSearchRe
 		}
 	}
 
+	applyRanking(query, pr.rankFeatures())
 	applyFacet(query, req)
 	applyPostFilter(query, req)
 	applySort(query, req)
+	applySuggest(query, req.Term)
 
-	if err := json.NewEncoder(&buf).Encode(query); err != nil {
-		log.Printf("productRepo.SearchFacet: Error encoding query: %s\n", err)
-		return nil, nil, 0, err
-	}
-
-	//println("=============================== ", buf.String())
-
-	// Perform the search request.
-	res, err := pr.client.Search(
-		pr.client.Search.WithContext(context.Background()),
-		pr.client.Search.WithIndex(pr.index),
-		pr.client.Search.WithBody(&buf),
-		pr.client.Search.WithTrackTotalHits(true),
-		pr.client.Search.WithPretty(),
-	)
+	r, info, err := pr.searchPage(ctx, "productRepo.SearchFacet", query, req.Page)
 	if err != nil {
-		log.Printf("productRepo.SearchFacet: Error sending query: %s\n", err)
-		return nil, nil, 0, err
+		return nil, search.PageInfo{}, err
 	}
-	defer res.Body.Close()
-
-	if res.IsError() {
-		var e map[string]interface{}
-		if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
-			log.Printf("productRepo.UpdateProductScore: Error decoding error response: %s\n", err)
-		} else {
-			log.Printf("productRepo.UpdateProductScore: Error response [%s] %s: %s",
-				res.Status(),
-				e["error"].(map[string]interface{})["type"],
-				e["error"].(map[string]interface{})["reason"],
-			)
-		}
 
-		return nil, nil, 0, infra.NewESResponseError("query returned error", e)
-	}
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		log.Printf("productRepo.Search: Error decoding success response: %s\n", err)
-		return nil, nil, 0, err
+	prds, err := pr.hits("productRepo.SearchFacet", r.Hits.Hits)
+	if err != nil {
+		return nil, search.PageInfo{}, err
 	}
 
-	total := int64(r["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64))
-	timeTaken := int64(r["took"].(float64))
-	log.Printf(
-		"[%s] %d hits; took: %dms\n",
-		res.Status(),
-		total,
-		timeTaken,
-	)
-
-	prds := []*search.Product{}
 	fcts := search.FacetRes{}
-	for _, hit := range r["hits"].(map[string]interface{})["hits"].([]interface{}) {
-		var b search.Product
-		if err := mapstructure.Decode(hit.(map[string]interface{})["_source"], &b); err != nil {
-			log.Printf("productRepo.Search: Error decoding response products: %s\n", err)
-			return nil, nil, 0, err
+	for _, f := range []struct {
+		path    []string
+		buckets *[]search.Bucket
+	}{
+		{path: []string{"brands", "brands_filtered"}, buckets: &fcts.Brands},
+		{path: []string{"shops", "shops_filtered"}, buckets: &fcts.Shops},
+		{path: []string{"categories", "categories_filtered"}, buckets: &fcts.Categories},
+		{path: []string{"colors", "color_filtered"}, buckets: &fcts.Colors},
+	} {
+		bckts, err := r.termsBuckets(f.path...)
+		if err != nil {
+			log.Printf("productRepo.SearchFacet: Error decoding response buckets: %s\n", err)
+			return nil, search.PageInfo{}, err
 		}
-		prds = append(prds, &b)
+		*f.buckets = toBuckets(bckts)
 	}
 
-	brnds := r["aggregations"].(map[string]interface{})["brands"].(map[string]interface{})["brands_filtered"].(map[string]interface{})["buckets"].([]interface{})
-	shps := r["aggregations"].(map[string]interface{})["shops"].(map[string]interface{})["shops_filtered"].(map[string]interface{})["buckets"].([]interface{})
-	ctgrs := r["aggregations"].(map[string]interface{})["categories"].(map[string]interface{})["categories_filtered"].(map[string]interface{})["buckets"].([]interface{})
-	clrs := r["aggregations"].(map[string]interface{})["colors"].(map[string]interface{})["color_filtered"].(map[string]interface{})["buckets"].([]interface{})
-
-	brBckts := []search.Bucket{}
-	for _, b := range brnds {
-		var bct search.Bucket
-		if err := mapstructure.Decode(b, &bct); err != nil {
-			log.Printf("productRepo.Search: Error decoding response brand bucket: %s\n", err)
-			return nil, nil, 0, err
-		}
-		brBckts = append(brBckts, bct)
+	fcts.CategoryTree, err = categoryTree(r, req.CategoryPath)
+	if err != nil {
+		log.Printf("productRepo.SearchFacet: Error decoding category tree: %s\n", err)
+		return nil, search.PageInfo{}, err
 	}
 
-	clrBckts := []search.Bucket{}
-	for _, b := range clrs {
-		var bct search.Bucket
-		if err := mapstructure.Decode(b, &bct); err != nil {
-			log.Printf("productRepo.Search: Error decoding response color bucket: %s\n", err)
-			return nil, nil, 0, err
-		}
-		clrBckts = append(clrBckts, bct)
+	fcts.Prices, err = priceFacet(r, req)
+	if err != nil {
+		log.Printf("productRepo.SearchFacet: Error decoding price facet: %s\n", err)
+		return nil, search.PageInfo{}, err
 	}
 
-	ctrBckts := []search.Bucket{}
-	for _, b := range ctgrs {
-		var bct search.Bucket
-		if err := mapstructure.Decode(b, &bct); err != nil {
-			log.Printf("productRepo.Search: Error decoding response category bucket: %s\n", err)
-			return nil, nil, 0, err
-		}
-		ctrBckts = append(ctrBckts, bct)
-	}
+	return &search.FacetSearchRes{
+		Products:    prds,
+		Facets:      &fcts,
+		Suggestions: spellingSuggestions(r, req.Term),
+	}, info, nil
+}
 
-	shpBckts := []search.Bucket{}
-	for _, b := range shps {
-		var bct search.Bucket
-		if err := mapstructure.Decode(b, &bct); err != nil {
-			log.Printf("productRepo.Search: Error decoding response shop bucket: %s\n", err)
-			return nil, nil, 0, err
-		}
-		shpBckts = append(shpBckts, bct)
+func toBuckets(bckts []esBucket) []search.Bucket {
+	res := make([]search.Bucket, 0, len(bckts))
+	for _, b := range bckts {
+		res = append(res, search.Bucket{
+			Key:      b.Key,
+			DocCount: b.DocCount,
+		})
 	}
 
-	fcts.Brands = brBckts
-	fcts.Categories = ctrBckts
-	fcts.Colors = clrBckts
-	fcts.Shops = shpBckts
-
-	return prds, &fcts, total, nil
+	return res
 }
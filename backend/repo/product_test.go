@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Product", func() {
+	Context("sorting: ", func() {
+		It("has a sort for every sort mode", func() {
+			for _, m := range search.SortModes() {
+				Expect(sortClauses).To(HaveKey(m))
+			}
+		})
+
+		It("sorts unknown modes by relevance", func() {
+			query := applySort(map[string]interface{}{}, search.FacetSearchReq{Sort: "name"})
+			Expect(query["sort"]).To(Equal(sortClauses[search.SortRelevance]))
+		})
+	})
+
+	Context("ranking: ", func() {
+		It("adds weighted rank features as optional clauses", func() {
+			query := applyRanking(map[string]interface{}{"query": "q"}, []config.RankFeature{
+				{Name: "sales", Weight: 2},
+				{Name: "stock", Weight: 0},
+				{Name: "rating", Weight: 1, Function: "sigmoid", Pivot: 3.5, Exponent: 2},
+			})
+
+			Expect(query["query"]).To(Equal(map[string]interface{}{
+				"bool": map[string]interface{}{
+					"must": "q",
+					"should": []map[string]interface{}{
+						{"rank_feature": map[string]interface{}{"field": "ranking.sales", "boost": 2.0, "saturation": map[string]interface{}{}}},
+						{"rank_feature": map[string]interface{}{"field": "ranking.rating", "boost": 1.0, "sigmoid": map[string]interface{}{"pivot": 3.5, "exponent": 2.0}}},
+					},
+				},
+			}))
+		})
+
+		It("leaves the query alone without rank features", func() {
+			Expect(applyRanking(map[string]interface{}{"query": "q"}, nil)).To(Equal(map[string]interface{}{"query": "q"}))
+		})
+	})
+})
+
+var _ = Describe("Popularity", func() {
+	var (
+		trnsprt *fakeTransport
+		pr      ProductRepo
+	)
+
+	BeforeEach(func() {
+		trnsprt = &fakeTransport{status: http.StatusOK}
+		pr = NewProductRepo(newFakeClient(trnsprt), RepoNameProduct)
+	})
+
+	It("adds log2 popularity to the products", func() {
+		trnsprt.response = `{"errors": false, "items": [{"update": {"_id": "7", "result": "updated", "status": 200}}]}`
+
+		_, err := pr.AddPopularity(context.Background(), map[int64]float64{7: 2800.5})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trnsprt.body).To(ContainSubstring(`"params": {"score": 2800.5}`))
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.pop_score_log2 = m + Math.log(1 + Math.pow(2, Math.min(c, s) - m)) / Math.log(2)`))
+	})
+})
+
+var _ = Describe("ProductRepo", func() {
+	var (
+		trnsprt *fakeTransport
+		pr      ProductRepo
+	)
+
+	BeforeEach(func() {
+		trnsprt = &fakeTransport{status: http.StatusOK}
+		pr = NewProductRepo(newFakeClient(trnsprt), RepoNameProduct)
+	})
+
+	It("keeps the creation time of products updated without one", func() {
+		trnsprt.response = `{"errors": false, "items": [{"update": {"_id": "7", "result": "updated", "status": 200}}]}`
+
+		_, err := pr.UpdateMany(context.Background(), []*search.Product{{ShopItemID: 7, Version: 2, Name: "Galaxy"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.name=params.name`))
+		Expect(trnsprt.body).NotTo(ContainSubstring(`created_at`))
+		Expect(trnsprt.body).NotTo(ContainSubstring(`status=params.status`))
+	})
+
+	It("deactivates products on update", func() {
+		trnsprt.response = `{"errors": false, "items": [{"update": {"_id": "7", "result": "updated", "status": 200}}]}`
+
+		inactive := false
+		_, err := pr.UpdateMany(context.Background(), []*search.Product{{ShopItemID: 7, Version: 2, Status: &inactive}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trnsprt.body).To(ContainSubstring(`ctx._source.status=params.status`))
+		Expect(trnsprt.body).To(ContainSubstring(`"status":false`))
+	})
+})
@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+)
+
+// rankFeatureClause boosts by a feature of the ranking field
+func rankFeatureClause(ft config.RankFeature) map[string]interface{} {
+	clause := map[string]interface{}{
+		"field": "ranking." + ft.Name,
+		"boost": ft.Weight,
+	}
+
+	switch ft.Function {
+	case "log":
+		clause["log"] = map[string]interface{}{
+			"scaling_factor": ft.ScalingFactor,
+		}
+	case "sigmoid":
+		clause["sigmoid"] = map[string]interface{}{
+			"pivot":    ft.Pivot,
+			"exponent": ft.Exponent,
+		}
+	default:
+		saturation := map[string]interface{}{}
+		if ft.Pivot > 0 {
+			saturation["pivot"] = ft.Pivot
+		}
+		clause["saturation"] = saturation
+	}
+
+	return map[string]interface{}{
+		"rank_feature": clause,
+	}
+}
+
+// applyRanking adds the rank features to the score of the query, documents
+// lacking a feature still match
+func applyRanking(query map[string]interface{}, fts []config.RankFeature) map[string]interface{} {
+	should := []map[string]interface{}{}
+	for _, ft := range fts {
+		if ft.Weight > 0 {
+			should = append(should, rankFeatureClause(ft))
+		}
+	}
+	if len(should) == 0 {
+		return query
+	}
+
+	query["query"] = map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   query["query"],
+			"should": should,
+		},
+	}
+
+	return query
+}
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -10,26 +11,62 @@ import (
 
 // Repo name const
 const (
-	RepoNameBrand   = "brands"
-	RepoNameShop    = "shops"
-	RepoNameProduct = "products"
+	RepoNameBrand    = "brands"
+	RepoNameShop     = "shops"
+	RepoNameProduct  = "products"
+	RepoNameCategory = "categories"
 )
 
 // Repo defines base repo interface
 type Repo interface {
-	EnsureIndexAndMapping() error
+	EnsureIndexAndMapping(ctx context.Context) error
+	Reindex(ctx context.Context) error
+	Rollback(ctx context.Context) error
 }
 
-// MigrateUp migrates up
-func MigrateUp(es *elasticsearch.Client) error {
-	prdRepo := NewProductRepo(es, RepoNameProduct)
-	brndRepo := NewBrandRepo(es, RepoNameBrand)
-	shpRepo := NewShopRepo(es, RepoNameShop)
+// RepoNames returns the names of every catalog repo
+func RepoNames() []string {
+	return []string{RepoNameProduct, RepoNameBrand, RepoNameShop, RepoNameCategory}
+}
+
+// newRepos returns the catalog repos by name
+func newRepos(es *elasticsearch.Client) map[string]Repo {
+	return map[string]Repo{
+		RepoNameProduct:  NewProductRepo(es, RepoNameProduct),
+		RepoNameBrand:    NewBrandRepo(es, RepoNameBrand),
+		RepoNameShop:     NewShopRepo(es, RepoNameShop),
+		RepoNameCategory: NewCategoryRepo(es, RepoNameCategory),
+	}
+}
+
+// selectRepos returns the repos named, every repo when none is named
+func selectRepos(es *elasticsearch.Client, names []string) ([]Repo, error) {
+	if len(names) == 0 {
+		names = RepoNames()
+	}
+
+	all := newRepos(es)
+	repos := make([]Repo, 0, len(names))
+	for _, n := range names {
+		r, ok := all[n]
+		if !ok {
+			return nil, fmt.Errorf("unknown repo %s, expected one of %v", n, RepoNames())
+		}
+		repos = append(repos, r)
+	}
 
-	repos := []Repo{prdRepo, brndRepo, shpRepo}
+	return repos, nil
+}
 
-	for _, v := range repos {
-		if err := v.EnsureIndexAndMapping(); err != nil {
+// Reindex moves the named repos, or every repo, into new index versions
+func Reindex(ctx context.Context, es *elasticsearch.Client, names ...string) error {
+	repos, err := selectRepos(es, names)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range repos {
+		if err := r.Reindex(ctx); err != nil {
 			return err
 		}
 	}
@@ -37,16 +74,20 @@ func MigrateUp(es *elasticsearch.Client) error {
 	return nil
 }
 
-// MigrateDown migrates up
-func MigrateDown(es *elasticsearch.Client) error {
-	_, err := es.Indices.Delete([]string{
-		RepoNameBrand, RepoNameProduct, RepoNameShop,
-	})
+// Rollback moves the named repos, or every repo, back to their previous index versions
+func Rollback(ctx context.Context, es *elasticsearch.Client, names ...string) error {
+	repos, err := selectRepos(es, names)
 	if err != nil {
-		log.Println("error deleting indices, error: ", err)
+		return err
 	}
 
-	return err
+	for _, r := range repos {
+		if err := r.Rollback(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func getConcurrencyControlledUpdateQuery(dataByte []byte, inlineJSONData string) []byte {
@@ -76,7 +117,7 @@ func getUpdateSourceString(buf []byte) (string, error) {
 		i++
 	}
 	if source != "" {
-		source = fmt.Sprintf(`"if (ctx._source.version < params.version) {%s}"`, source)
+		source = fmt.Sprintf(`"if (ctx._source.version < params.version) {%s} else { ctx.op = 'noop' }"`, source)
 	}
 
 	return source, nil
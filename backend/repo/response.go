@@ -0,0 +1,175 @@
+package repo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/infra"
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+)
+
+type esTotal struct {
+	Value    int64  `json:"value"`
+	Relation string `json:"relation"`
+}
+
+type esHit struct {
+	Index     string              `json:"_index"`
+	ID        string              `json:"_id"`
+	Score     *float64            `json:"_score"`
+	Source    json.RawMessage     `json:"_source"`
+	Sort      []json.RawMessage   `json:"sort"`
+	Highlight map[string][]string `json:"highlight"`
+}
+
+type esHits struct {
+	Total *esTotal `json:"total"`
+	Hits  []esHit  `json:"hits"`
+}
+
+type esSearchResponse struct {
+	Took         int64                      `json:"took"`
+	TimedOut     bool                       `json:"timed_out"`
+	PitID        string                     `json:"pit_id"`
+	Hits         *esHits                    `json:"hits"`
+	Aggregations map[string]json.RawMessage `json:"aggregations"`
+	Suggest      map[string][]esSuggestion  `json:"suggest"`
+}
+
+type esSuggestOption struct {
+	Text        string  `json:"text"`
+	Highlighted string  `json:"highlighted"`
+	Score       float64 `json:"score"`
+}
+
+type esSuggestion struct {
+	Text    string            `json:"text"`
+	Offset  int               `json:"offset"`
+	Length  int               `json:"length"`
+	Options []esSuggestOption `json:"options"`
+}
+
+type esBucket struct {
+	Key      string `json:"key"`
+	DocCount int64  `json:"doc_count"`
+}
+
+type esTermsAgg struct {
+	Buckets []esBucket `json:"buckets"`
+}
+
+type esFilterAgg struct {
+	DocCount int64 `json:"doc_count"`
+}
+
+type esStatsAgg struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+type esHistogramAgg struct {
+	Buckets []struct {
+		Key      float64 `json:"key"`
+		DocCount int64   `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+type esRangeAgg struct {
+	Buckets []struct {
+		From     *float64 `json:"from"`
+		To       *float64 `json:"to"`
+		DocCount int64    `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+type esIndexResponse struct {
+	ID      string `json:"_id"`
+	Result  string `json:"result"`
+	Version int64  `json:"_version"`
+}
+
+func newMalformedResponseError(format string, args ...interface{}) error {
+	return infra.NewESResponseError("malformed response: "+fmt.Sprintf(format, args...), nil)
+}
+
+// decodeSearchResponse decodes a successful search response, a response
+// without hits or totals is reported as malformed
+func decodeSearchResponse(body io.Reader) (*esSearchResponse, error) {
+	var r esSearchResponse
+	if err := json.NewDecoder(body).Decode(&r); err != nil {
+		return nil, newMalformedResponseError("%s", err)
+	}
+	if r.Hits == nil || r.Hits.Total == nil {
+		return nil, newMalformedResponseError("missing hits")
+	}
+
+	return &r, nil
+}
+
+// aggregation decodes the (sub) aggregation at path into v
+func (r *esSearchResponse) aggregation(v interface{}, path ...string) error {
+	aggs := r.Aggregations
+	for i, name := range path {
+		raw, ok := aggs[name]
+		if !ok {
+			return newMalformedResponseError("missing aggregation %v", path[:i+1])
+		}
+
+		if i == len(path)-1 {
+			if err := json.Unmarshal(raw, v); err != nil {
+				return newMalformedResponseError("aggregation %v: %s", path, err)
+			}
+			break
+		}
+
+		aggs = nil
+		if err := json.Unmarshal(raw, &aggs); err != nil {
+			return newMalformedResponseError("aggregation %v: %s", path[:i+1], err)
+		}
+	}
+
+	return nil
+}
+
+// termsBuckets returns the buckets of the terms aggregation at path
+func (r *esSearchResponse) termsBuckets(path ...string) ([]esBucket, error) {
+	var agg esTermsAgg
+	if err := r.aggregation(&agg, path...); err != nil {
+		return nil, err
+	}
+
+	return agg.Buckets, nil
+}
+
+// errorCause extracts the error type and reason of an error response, the
+// error is an object for most apis but a plain string for some
+func errorCause(e map[string]interface{}) (string, string) {
+	switch cause := e["error"].(type) {
+	case map[string]interface{}:
+		typ, _ := cause["type"].(string)
+		reason, _ := cause["reason"].(string)
+		return typ, reason
+	case string:
+		return "", cause
+	}
+
+	return "", ""
+}
+
+// decodeErrorResponse logs an error response of op and returns it as an ESResponseError
+func decodeErrorResponse(op string, res *esapi.Response) error {
+	var e map[string]interface{}
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+		log.Printf("%s: Error decoding error response: %s\n", op, err)
+		return infra.NewESResponseError("query returned error", map[string]interface{}{
+			"status": res.StatusCode,
+		})
+	}
+
+	typ, reason := errorCause(e)
+	log.Printf("%s: Error response [%s] %s: %s", op, res.Status(), typ, reason)
+
+	return infra.NewESResponseError("query returned error", e)
+}
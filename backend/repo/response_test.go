@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/infra"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Response", func() {
+	Context("decoding search response: ", func() {
+		It("decodes hits, totals and nested aggregations", func() {
+			body := `{
+				"took": 7,
+				"hits": {
+					"total": {"value": 2, "relation": "eq"},
+					"hits": [
+						{"_id": "1", "_score": 1.2, "_source": {"name": "galaxy"}},
+						{"_id": "2", "_score": null, "_source": {"name": "pixel"}}
+					]
+				},
+				"aggregations": {
+					"brands": {
+						"doc_count": 2,
+						"brands_filtered": {"buckets": [{"key": "samsung", "doc_count": 1}, {"key": "google", "doc_count": 1}]}
+					}
+				}
+			}`
+
+			r, err := decodeSearchResponse(strings.NewReader(body))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(r.Took).To(Equal(int64(7)))
+			Expect(r.Hits.Total.Value).To(Equal(int64(2)))
+			Expect(r.Hits.Hits).To(HaveLen(2))
+			Expect(r.Hits.Hits[1].Score).To(BeNil())
+
+			bckts, err := r.termsBuckets("brands", "brands_filtered")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bckts).To(Equal([]esBucket{{Key: "samsung", DocCount: 1}, {Key: "google", DocCount: 1}}))
+		})
+
+		It("reports missing hits as ESResponseError", func() {
+			_, err := decodeSearchResponse(strings.NewReader(`{"took": 1}`))
+			Expect(err).To(BeAssignableToTypeOf(&infra.ESResponseError{}))
+		})
+
+		It("reports missing aggregations as ESResponseError", func() {
+			r, err := decodeSearchResponse(strings.NewReader(`{"hits": {"total": {"value": 0}, "hits": []}}`))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = r.termsBuckets("brands", "brands_filtered")
+			Expect(err).To(BeAssignableToTypeOf(&infra.ESResponseError{}))
+			Expect(err.Error()).To(ContainSubstring("brands"))
+		})
+	})
+
+	Context("extracting error cause: ", func() {
+		It("handles object, string and missing errors", func() {
+			typ, reason := errorCause(map[string]interface{}{
+				"error": map[string]interface{}{"type": "index_not_found_exception", "reason": "no such index"},
+			})
+			Expect(typ).To(Equal("index_not_found_exception"))
+			Expect(reason).To(Equal("no such index"))
+
+			typ, reason = errorCause(map[string]interface{}{"error": "alias [products] missing"})
+			Expect(typ).To(BeEmpty())
+			Expect(reason).To(Equal("alias [products] missing"))
+
+			typ, reason = errorCause(map[string]interface{}{})
+			Expect(typ).To(BeEmpty())
+			Expect(reason).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,82 @@
+package repo
+
+// SynonymsFile is the synonyms file of the catalog analyzers, relative to
+// the config directory of every elasticsearch node
+const SynonymsFile = "analysis/synonyms.txt"
+
+// IndexSettings are the analysis settings every catalog index is created with.
+//
+// catalog_index splits words on case changes, digits and delimiters while
+// keeping the catenated word ("t-shirt" is indexed as "t-shirt", "t", "shirt"
+// and "tshirt"), folds to ASCII and applies a light stemmer. catalog_search
+// does the same and expands the synonyms of SynonymsFile, it is updateable so
+// the synonyms can be reloaded without closing the indices. Synonyms are
+// parsed with the filters before them and elasticsearch can't parse them
+// through a word delimiter, so they are expanded before words are split.
+//
+// catalog_suggest and catalog_shingle only fold case and accents, without
+// stemming, so spelling suggestions are built from the words as written.
+// catalog_shingle adds the word pairs and triples the phrase suggester
+// scores corrections with.
+const IndexSettings = `{
+	"analysis" : {
+	  "filter" : {
+		"catalog_word_delimiter" : {
+		  "type" : "word_delimiter_graph",
+		  "catenate_words" : true,
+		  "preserve_original" : true
+		},
+		"catalog_stemmer" : {
+		  "type" : "stemmer",
+		  "language" : "light_english"
+		},
+		"catalog_synonyms" : {
+		  "type" : "synonym_graph",
+		  "synonyms_path" : "` + SynonymsFile + `",
+		  "updateable" : true
+		},
+		"catalog_shingle" : {
+		  "type" : "shingle",
+		  "min_shingle_size" : 2,
+		  "max_shingle_size" : 3
+		}
+	  },
+	  "analyzer" : {
+		"catalog_index" : {
+		  "tokenizer" : "whitespace",
+		  "filter" : [
+			"catalog_word_delimiter",
+			"flatten_graph",
+			"lowercase",
+			"asciifolding",
+			"catalog_stemmer"
+		  ]
+		},
+		"catalog_search" : {
+		  "tokenizer" : "whitespace",
+		  "filter" : [
+			"lowercase",
+			"asciifolding",
+			"catalog_synonyms",
+			"catalog_word_delimiter",
+			"catalog_stemmer"
+		  ]
+		},
+		"catalog_suggest" : {
+		  "tokenizer" : "standard",
+		  "filter" : [
+			"lowercase",
+			"asciifolding"
+		  ]
+		},
+		"catalog_shingle" : {
+		  "tokenizer" : "standard",
+		  "filter" : [
+			"lowercase",
+			"asciifolding",
+			"catalog_shingle"
+		  ]
+		}
+	  }
+	}
+  }`
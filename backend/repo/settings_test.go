@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Settings", func() {
+	It("expands synonyms before splitting words on search", func() {
+		var settings struct {
+			Analysis struct {
+				Analyzer map[string]struct {
+					Filter []string `json:"filter"`
+				} `json:"analyzer"`
+			} `json:"analysis"`
+		}
+		Expect(json.Unmarshal([]byte(IndexSettings), &settings)).To(Succeed())
+
+		filters := settings.Analysis.Analyzer["catalog_search"].Filter
+		Expect(filters).To(Equal([]string{"lowercase", "asciifolding", "catalog_synonyms", "catalog_word_delimiter", "catalog_stemmer"}))
+	})
+})
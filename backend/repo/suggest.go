@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// suggestions to return for a misspelled term
+const suggestSize = 3
+
+// suggest names of the suggesters of a facet search
+const (
+	suggestPhrase     = "phrase"
+	suggestNameTerms  = "name_terms"
+	suggestBrandTerms = "brand_terms"
+)
+
+// applySuggest adds spelling suggestions for term built from the product and
+// brand names. The phrase suggester corrects the term as a whole and only
+// keeps corrections that match a product, the term suggesters correct word
+// by word for when no phrase is found.
+func applySuggest(query map[string]interface{}, term string) {
+	if strings.TrimSpace(term) == "" {
+		return
+	}
+
+	termSuggester := func(field string) map[string]interface{} {
+		return map[string]interface{}{
+			"term": map[string]interface{}{
+				"field":        field,
+				"suggest_mode": "popular",
+				"size":         1,
+			},
+		}
+	}
+
+	query["suggest"] = map[string]interface{}{
+		"text": term,
+		suggestPhrase: map[string]interface{}{
+			"phrase": map[string]interface{}{
+				"field":      "name.shingle",
+				"size":       suggestSize,
+				"gram_size":  3,
+				"max_errors": 2,
+				"direct_generator": []map[string]interface{}{
+					{"field": "name.suggest", "suggest_mode": "always"},
+					{"field": "brand_name.suggest", "suggest_mode": "always"},
+				},
+				"highlight": map[string]interface{}{
+					"pre_tag":  highlightPreTag,
+					"post_tag": highlightPostTag,
+				},
+				"collate": map[string]interface{}{
+					"query": map[string]interface{}{
+						"source": map[string]interface{}{
+							"multi_match": map[string]interface{}{
+								"query":    "{{suggestion}}",
+								"fields":   []string{"name", "brand_name"},
+								"operator": "and",
+							},
+						},
+					},
+				},
+			},
+		},
+		suggestNameTerms:  termSuggester("name.suggest"),
+		suggestBrandTerms: termSuggester("brand_name.suggest"),
+	}
+}
+
+// spellingSuggestions returns the phrase suggestions of r, or when there are
+// none the term corrected word by word with the best term suggestions
+func spellingSuggestions(r *esSearchResponse, term string) []search.Suggestion {
+	sgs := []search.Suggestion{}
+	for _, s := range r.Suggest[suggestPhrase] {
+		for _, o := range s.Options {
+			sgs = append(sgs, search.Suggestion{Text: o.Text, Highlighted: o.Highlighted, Score: o.Score})
+		}
+	}
+	if len(sgs) > 0 {
+		return sgs
+	}
+
+	// best option per word, keyed by the offset of the word in term
+	best := map[int]esSuggestion{}
+	for _, name := range []string{suggestNameTerms, suggestBrandTerms} {
+		for _, s := range r.Suggest[name] {
+			if len(s.Options) == 0 {
+				continue
+			}
+			if b, ok := best[s.Offset]; !ok || s.Options[0].Score > b.Options[0].Score {
+				best[s.Offset] = s
+			}
+		}
+	}
+	if len(best) == 0 {
+		return sgs
+	}
+
+	offsets := make([]int, 0, len(best))
+	for o := range best {
+		offsets = append(offsets, o)
+	}
+	sort.Ints(offsets)
+
+	// offsets count characters, not bytes
+	chars := []rune(term)
+	var text, hl strings.Builder
+	score, prev, n := 0.0, 0, 0
+	for _, o := range offsets {
+		s := best[o]
+		if o < prev || o+s.Length > len(chars) {
+			continue
+		}
+		text.WriteString(string(chars[prev:o]))
+		hl.WriteString(string(chars[prev:o]))
+		text.WriteString(s.Options[0].Text)
+		hl.WriteString(highlightPreTag + s.Options[0].Text + highlightPostTag)
+		score += s.Options[0].Score
+		prev = o + s.Length
+		n++
+	}
+	if n == 0 {
+		return sgs
+	}
+	text.WriteString(string(chars[prev:]))
+	hl.WriteString(string(chars[prev:]))
+
+	return append(sgs, search.Suggestion{
+		Text:        text.String(),
+		Highlighted: hl.String(),
+		Score:       score / float64(n),
+	})
+}
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Suggest", func() {
+	It("skips suggestions without a term", func() {
+		query := map[string]interface{}{}
+		applySuggest(query, " ")
+		Expect(query).NotTo(HaveKey("suggest"))
+
+		applySuggest(query, "nikee")
+		Expect(query).To(HaveKey("suggest"))
+	})
+
+	It("prefers phrase suggestions", func() {
+		r := &esSearchResponse{Suggest: map[string][]esSuggestion{
+			suggestPhrase: {{Text: "nikee shoes", Options: []esSuggestOption{
+				{Text: "nike shoes", Highlighted: "<em>nike</em> shoes", Score: 0.4},
+			}}},
+			suggestNameTerms: {{Text: "nikee", Length: 5, Options: []esSuggestOption{{Text: "nikes", Score: 0.8}}}},
+		}}
+
+		Expect(spellingSuggestions(r, "nikee shoes")).To(Equal([]search.Suggestion{
+			{Text: "nike shoes", Highlighted: "<em>nike</em> shoes", Score: 0.4},
+		}))
+	})
+
+	It("corrects word by word with the best term suggestions", func() {
+		r := &esSearchResponse{Suggest: map[string][]esSuggestion{
+			suggestPhrase: {{Text: "nikee runing shoes"}},
+			suggestNameTerms: {
+				{Text: "nikee", Offset: 0, Length: 5, Options: []esSuggestOption{{Text: "nikes", Score: 0.6}}},
+				{Text: "runing", Offset: 6, Length: 6, Options: []esSuggestOption{{Text: "running", Score: 0.8}}},
+			},
+			suggestBrandTerms: {
+				{Text: "nikee", Offset: 0, Length: 5, Options: []esSuggestOption{{Text: "nike", Score: 0.8}}},
+			},
+		}}
+
+		Expect(spellingSuggestions(r, "nikee runing shoes")).To(Equal([]search.Suggestion{{
+			Text:        "nike running shoes",
+			Highlighted: "<em>nike</em> <em>running</em> shoes",
+			Score:       0.8,
+		}}))
+	})
+
+	It("corrects words after multibyte characters", func() {
+		r := &esSearchResponse{Suggest: map[string][]esSuggestion{
+			suggestNameTerms: {
+				{Text: "café", Offset: 0, Length: 4},
+				{Text: "noir", Offset: 5, Length: 4, Options: []esSuggestOption{{Text: "noire", Score: 0.7}}},
+			},
+		}}
+
+		Expect(spellingSuggestions(r, "café noir mug")).To(Equal([]search.Suggestion{{
+			Text:        "café noire mug",
+			Highlighted: "café <em>noire</em> mug",
+			Score:       0.7,
+		}}))
+	})
+
+	It("suggests nothing when every word is spelled right", func() {
+		r := &esSearchResponse{Suggest: map[string][]esSuggestion{
+			suggestNameTerms: {{Text: "shoes", Length: 5}},
+		}}
+		Expect(spellingSuggestions(r, "shoes")).To(BeEmpty())
+	})
+})
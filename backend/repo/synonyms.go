@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// ParseSynonyms reads solr formatted synonym rules from r, i.e.
+// "tshirt, t-shirt, tee" or "mobile => phone". Blank lines and # comments
+// are dropped.
+func ParseSynonyms(r io.Reader) ([]string, error) {
+	rules := []string{}
+	scnr := bufio.NewScanner(r)
+	for n := 1; scnr.Scan(); n++ {
+		line := strings.TrimSpace(scnr.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		terms := line
+		if i := strings.Index(line, "=>"); i >= 0 {
+			if strings.TrimSpace(line[:i]) == "" || strings.TrimSpace(line[i+2:]) == "" {
+				return nil, fmt.Errorf("line %d: %q needs terms on both sides of =>", n, line)
+			}
+			terms = line[:i] + "," + line[i+2:]
+		} else if !strings.Contains(line, ",") {
+			return nil, fmt.Errorf("line %d: %q needs at least two comma separated terms", n, line)
+		}
+		for _, t := range strings.Split(terms, ",") {
+			if strings.TrimSpace(t) == "" {
+				return nil, fmt.Errorf("line %d: %q has an empty term", n, line)
+			}
+		}
+
+		rules = append(rules, line)
+	}
+	if err := scnr.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// ReloadSynonyms reloads the search analyzers of the catalog indices so
+// they pick up a changed synonyms file without closing the indices
+func ReloadSynonyms(ctx context.Context, es *elasticsearch.Client) error {
+	res, err := es.Indices.ReloadSearchAnalyzers(
+		RepoNames(),
+		es.Indices.ReloadSearchAnalyzers.WithContext(ctx),
+	)
+	if err != nil {
+		log.Println("error reloading search analyzers, error: ", err)
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		return decodeErrorResponse("ReloadSynonyms", res)
+	}
+
+	return nil
+}
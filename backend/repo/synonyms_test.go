@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Synonyms", func() {
+	It("keeps equivalent and explicit rules, dropping comments", func() {
+		rules, err := ParseSynonyms(strings.NewReader("# clothes\ntshirt, t-shirt\n\nmobile => phone\n"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rules).To(Equal([]string{"tshirt, t-shirt", "mobile => phone"}))
+	})
+
+	It("rejects rules without synonyms", func() {
+		_, err := ParseSynonyms(strings.NewReader("tshirt, t-shirt\nphone\n"))
+		Expect(err).To(MatchError(ContainSubstring("line 2")))
+
+		_, err = ParseSynonyms(strings.NewReader("mobile =>\n"))
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,20 @@
+package repo
+
+// applyVisibility filters the documents not passing filters out of query,
+// filters don't take part in scoring
+func applyVisibility(query map[string]interface{}, filters []map[string]interface{}) {
+	if len(filters) == 0 {
+		return
+	}
+
+	q, ok := query["query"]
+	if !ok {
+		q = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	query["query"] = map[string]interface{}{
+		"bool": map[string]interface{}{
+			"must":   q,
+			"filter": filters,
+		},
+	}
+}
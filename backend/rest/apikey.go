@@ -0,0 +1,126 @@
+package rest
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+)
+
+// Scope defines what an api key is allowed to do
+type Scope string
+
+// api key scopes, admin grants every other scope, events grants posting
+// click stream events
+const (
+	ScopeRead   Scope = "read"
+	ScopeWrite  Scope = "write"
+	ScopeEvents Scope = "events"
+	ScopeAdmin  Scope = "admin"
+)
+
+type apiKey struct {
+	name      string
+	digest    [sha256.Size]byte
+	scopes    map[Scope]bool
+	expiresAt time.Time
+}
+
+func (k *apiKey) allows(scope Scope) bool {
+	return k.scopes[ScopeAdmin] || k.scopes[scope]
+}
+
+func (k *apiKey) expired(now time.Time) bool {
+	return !k.expiresAt.IsZero() && now.After(k.expiresAt)
+}
+
+// KeyStore holds the active api keys. It is safe for concurrent use and
+// its keys can be replaced at runtime to rotate them without downtime.
+type KeyStore struct {
+	mu   sync.RWMutex
+	keys []*apiKey
+}
+
+// NewKeyStore returns a KeyStore holding keys
+func NewKeyStore(keys []config.APIKey) (*KeyStore, error) {
+	ks := &KeyStore{}
+	if err := ks.Replace(keys); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Replace swaps the active keys with keys, the current keys are kept if any key is invalid
+func (ks *KeyStore) Replace(keys []config.APIKey) error {
+	aks := make([]*apiKey, 0, len(keys))
+	for _, k := range keys {
+		ak := &apiKey{
+			name:      k.Name,
+			digest:    sha256.Sum256([]byte(k.Key)),
+			scopes:    make(map[Scope]bool, len(k.Scopes)),
+			expiresAt: k.ExpiresAt,
+		}
+		if k.KeySHA256 != "" {
+			d, err := hex.DecodeString(k.KeySHA256)
+			if err != nil || len(d) != sha256.Size {
+				return fmt.Errorf("api key %s has an invalid key_sha256", k.Name)
+			}
+			copy(ak.digest[:], d)
+		}
+		for _, s := range k.Scopes {
+			switch scp := Scope(s); scp {
+			case ScopeRead, ScopeWrite, ScopeEvents, ScopeAdmin:
+				ak.scopes[scp] = true
+			default:
+				return fmt.Errorf("api key %s has unknown scope %q", k.Name, s)
+			}
+		}
+		aks = append(aks, ak)
+	}
+
+	ks.mu.Lock()
+	ks.keys = aks
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// Authenticate returns the name of the active key matching key and whether the
+// key grants scope. Every active key is compared in constant time so neither
+// the position nor the prefix of a matching key leaks through timing.
+func (ks *KeyStore) Authenticate(key string, scope Scope) (string, bool) {
+	digest := sha256.Sum256([]byte(key))
+	now := time.Now()
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var match *apiKey
+	for _, k := range ks.keys {
+		if subtle.ConstantTimeCompare(digest[:], k.digest[:]) == 1 && !k.expired(now) {
+			match = k
+		}
+	}
+
+	if match == nil {
+		return "", false
+	}
+
+	return match.name, match.allows(scope)
+}
+
+type ctxKey string
+
+const ctxKeyAPIKeyName ctxKey = "api_key_name"
+
+// APIKeyName returns the name of the api key that authenticated the request, if any
+func APIKeyName(ctx context.Context) string {
+	name, _ := ctx.Value(ctxKeyAPIKeyName).(string)
+	return name
+}
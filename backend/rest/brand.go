@@ -12,12 +12,14 @@ import (
 // BrandHandler defines brand handler
 type BrandHandler struct {
 	svc search.Service
+	ks  *KeyStore
 }
 
 // NewBrandHandler ...
-func NewBrandHandler(svc search.Service) *BrandHandler {
+func NewBrandHandler(svc search.Service, ks *KeyStore) *BrandHandler {
 	return &BrandHandler{
 		svc: svc,
+		ks:  ks,
 	}
 }
 
@@ -25,10 +27,13 @@ func NewBrandHandler(svc search.Service) *BrandHandler {
 func (h *BrandHandler) Router() http.Handler {
 	router := chi.NewRouter()
 
-	router.Get("/", h.SearchAsYouTypeBrand)
-	router.Post("/bulk-insert", h.AddBrands)
-	router.Post("/bulk-delete", h.DeleteBrands)
-	router.Post("/bulk-update", h.UpdateBrands)
+	router.With(IncludeHiddenAdminOnly(h.ks)).Get("/", h.SearchAsYouTypeBrand)
+	router.Group(func(r chi.Router) {
+		r.Use(APIKeyOnly(h.ks, ScopeWrite))
+		r.Post("/bulk-insert", h.AddBrands)
+		r.Post("/bulk-delete", h.DeleteBrands)
+		r.Post("/bulk-update", h.UpdateBrands)
+	})
 
 	return router
 }
@@ -36,17 +41,16 @@ func (h *BrandHandler) Router() http.Handler {
 // SearchAsYouTypeBrand ...
 func (h *BrandHandler) SearchAsYouTypeBrand(w http.ResponseWriter, r *http.Request) {
 	term := r.URL.Query().Get("term")
-	pager := getPager(r)
-	skip := (pager.Page - 1) * pager.Limit
-	limit := pager.Limit
+	page := getPage(r)
 
-	brnds, total, err := h.svc.SearchBrandAsType(r.Context(), term, skip, limit)
+	brnds, info, err := h.svc.SearchBrandAsType(r.Context(), term, page)
 	if err != nil {
-		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+		log.Println("brandHandler.SearchAsYouTypeBrand =>  service error: ", err)
+		serveSearchError(w, err)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", brnds, &total, nil)
+	serveSearchPage(w, searchResults(brnds, page), info)
 	return
 }
 
@@ -65,13 +69,13 @@ func (h *BrandHandler) AddBrands(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	brnds, err = h.svc.AddBrands(r.Context(), brnds)
+	res, err := h.svc.AddBrands(r.Context(), brnds)
 	if err != nil {
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", brnds, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
 
@@ -90,13 +94,13 @@ func (h *BrandHandler) UpdateBrands(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	brnds, err = h.svc.UpdateBrands(r.Context(), brnds)
+	res, err := h.svc.UpdateBrands(r.Context(), brnds)
 	if err != nil {
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", brnds, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
 
@@ -120,12 +124,12 @@ func (h *BrandHandler) DeleteBrands(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.svc.DeleteBrands(r.Context(), dbrq.IDS)
+	res, err := h.svc.DeleteBrands(r.Context(), dbrq.IDS)
 	if err != nil {
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", nil, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
@@ -0,0 +1,135 @@
+package rest
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/go-chi/chi"
+)
+
+// CategoryHandler defines category handler
+type CategoryHandler struct {
+	svc search.Service
+	ks  *KeyStore
+}
+
+// NewCategoryHandler ...
+func NewCategoryHandler(svc search.Service, ks *KeyStore) *CategoryHandler {
+	return &CategoryHandler{
+		svc: svc,
+		ks:  ks,
+	}
+}
+
+// Router ..
+func (h *CategoryHandler) Router() http.Handler {
+	router := chi.NewRouter()
+
+	router.With(IncludeHiddenAdminOnly(h.ks)).Get("/", h.SearchAsYouTypeCategory)
+	router.Group(func(r chi.Router) {
+		r.Use(APIKeyOnly(h.ks, ScopeWrite))
+		r.Post("/bulk-insert", h.AddCategories)
+		r.Post("/bulk-delete", h.DeleteCategories)
+		r.Post("/bulk-update", h.UpdateCategories)
+	})
+
+	return router
+}
+
+// SearchAsYouTypeCategory ...
+func (h *CategoryHandler) SearchAsYouTypeCategory(w http.ResponseWriter, r *http.Request) {
+	term := r.URL.Query().Get("term")
+	page := getPage(r)
+
+	ctgrs, info, err := h.svc.SearchCategoryAsType(r.Context(), term, page)
+	if err != nil {
+		log.Println("categoryHandler.SearchAsYouTypeCategory =>  service error: ", err)
+		serveSearchError(w, err)
+		return
+	}
+
+	serveSearchPage(w, searchResults(ctgrs, page), info)
+	return
+}
+
+// AddCategories ...
+func (h *CategoryHandler) AddCategories(w http.ResponseWriter, r *http.Request) {
+	ctgrs := []*search.Category{}
+	err := json.NewDecoder(r.Body).Decode(&ctgrs)
+	if err != nil {
+		log.Println("categoryHandler.AddCategories =>  invalid request body: ", err)
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "invalid request body", nil, nil, nil)
+		return
+	}
+	if len(ctgrs) == 0 {
+		log.Println("categoryHandler.AddCategories =>  invalid request body: ", err)
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "no categories to insert in request body", nil, nil, nil)
+		return
+	}
+
+	res, err := h.svc.AddCategories(r.Context(), ctgrs)
+	if err != nil {
+		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+		return
+	}
+
+	serveBulkResult(w, res)
+	return
+}
+
+// UpdateCategories ...
+func (h *CategoryHandler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
+	ctgrs := []*search.Category{}
+	err := json.NewDecoder(r.Body).Decode(&ctgrs)
+	if err != nil {
+		log.Println("categoryHandler.UpdateCategories =>  invalid request body: ", err)
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "invalid request body", nil, nil, nil)
+		return
+	}
+	if len(ctgrs) == 0 {
+		log.Println("categoryHandler.UpdateCategories =>  invalid request body: ", err)
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "no categories to insert in request body", nil, nil, nil)
+		return
+	}
+
+	res, err := h.svc.UpdateCategories(r.Context(), ctgrs)
+	if err != nil {
+		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+		return
+	}
+
+	serveBulkResult(w, res)
+	return
+}
+
+// DeleteCategoriesReq ...
+type DeleteCategoriesReq struct {
+	IDS []int64 `json:"ids"`
+}
+
+// DeleteCategories ...
+func (h *CategoryHandler) DeleteCategories(w http.ResponseWriter, r *http.Request) {
+	dcrq := &DeleteCategoriesReq{}
+	err := json.NewDecoder(r.Body).Decode(&dcrq)
+	if err != nil {
+		log.Println("categoryHandler.DeleteCategories =>  invalid request body: ", err)
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "invalid request body", nil, nil, nil)
+		return
+	}
+	if len(dcrq.IDS) == 0 {
+		log.Println("categoryHandler.DeleteCategories =>  invalid request body: ", err)
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "no categories id to delete in request body", nil, nil, nil)
+		return
+	}
+
+	res, err := h.svc.DeleteCategories(r.Context(), dcrq.IDS)
+	if err != nil {
+		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+		return
+	}
+
+	serveBulkResult(w, res)
+	return
+}
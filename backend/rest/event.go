@@ -0,0 +1,62 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/go-chi/chi"
+)
+
+// EventHandler defines click stream event handler
+type EventHandler struct {
+	trckr *search.Tracker
+	ks    *KeyStore
+}
+
+// NewEventHandler ...
+func NewEventHandler(trckr *search.Tracker, ks *KeyStore) *EventHandler {
+	return &EventHandler{
+		trckr: trckr,
+		ks:    ks,
+	}
+}
+
+// Router ..
+func (h *EventHandler) Router() http.Handler {
+	router := chi.NewRouter()
+
+	router.With(APIKeyOnly(h.ks, ScopeEvents)).Post("/", h.TrackEvents)
+
+	return router
+}
+
+// TrackEvents ...
+func (h *EventHandler) TrackEvents(w http.ResponseWriter, r *http.Request) {
+	evnts := []*search.ClickStream{}
+	err := json.NewDecoder(r.Body).Decode(&evnts)
+	if err != nil {
+		log.Println("eventHandler.TrackEvents =>  invalid request body: ", err)
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "invalid request body", nil, nil, nil)
+		return
+	}
+	if len(evnts) == 0 {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "no events to track in request body", nil, nil, nil)
+		return
+	}
+
+	if err := h.trckr.Track(evnts...); err != nil {
+		if errors.Is(err, search.ErrInvalidEvent) {
+			ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, err.Error(), nil, nil, nil)
+			return
+		}
+		log.Println("eventHandler.TrackEvents =>  tracker error: ", err)
+		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+		return
+	}
+
+	ServeJSON(w, "", http.StatusAccepted, "Accepted", nil, nil, nil)
+	return
+}
@@ -0,0 +1,42 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/rest"
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TrackEvents", func() {
+	var hndl http.Handler
+
+	serve := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"event_id": "e1", "shop_item_id": 7, "event": "click"}]`))
+		if key != "" {
+			req.Header.Set("X-API-KEY", key)
+		}
+		rec := httptest.NewRecorder()
+		hndl.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		ks, err := rest.NewKeyStore([]config.APIKey{
+			{Name: "storefront", Key: "storefront-key", Scopes: []string{"events"}},
+			{Name: "frontend", Key: "frontend-key", Scopes: []string{"read"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		hndl = rest.NewEventHandler(search.NewTracker(nil, search.TrackerConfig{}), ks).Router()
+	})
+
+	It("takes events only from keys with the events scope", func() {
+		Expect(serve("")).To(Equal(http.StatusUnauthorized))
+		Expect(serve("frontend-key")).To(Equal(http.StatusForbidden))
+		Expect(serve("storefront-key")).To(Equal(http.StatusAccepted))
+	})
+})
@@ -2,8 +2,11 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
 )
 
 // Code  ...
@@ -17,18 +20,21 @@ type Response struct {
 	Success bool        `json:"success,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Count   *int64      `json:"count,omitempty"`
-	Errors  interface{} `json:"errors,omitempty"`
+	// NextCursor continues cursor pagination, it is empty on the last page
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Errors     interface{} `json:"errors,omitempty"`
 }
 
 // ServeJSON serves json to http client
 func (r *Response) ServeJSON(w http.ResponseWriter) error {
 	resp := &Response{
-		Code:    r.Code,
-		Status:  r.Status,
-		Message: r.Message,
-		Data:    r.Data,
-		Errors:  r.Errors,
-		Count:   r.Count,
+		Code:       r.Code,
+		Status:     r.Status,
+		Message:    r.Message,
+		Data:       r.Data,
+		Errors:     r.Errors,
+		Count:      r.Count,
+		NextCursor: r.NextCursor,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -64,6 +70,13 @@ func ServeJSON(w http.ResponseWriter, code Code, status int, message string, dat
 	return nil
 }
 
+// invalidArg describes a rejected request argument and the values it accepts
+type invalidArg struct {
+	Field   string      `json:"field"`
+	Value   interface{} `json:"value"`
+	Allowed interface{} `json:"allowed,omitempty"`
+}
+
 type reqList struct {
 	Limit int64 `json:"limit"`
 	Page  int64 `json:"page"`
@@ -94,3 +107,68 @@ func getPager(r *http.Request) *reqList {
 
 	return rs
 }
+
+// serveBulkResult serves the per document outcome of a bulk request,
+// a partially applied request is served as multi status
+func serveBulkResult(w http.ResponseWriter, res *search.BulkResult) error {
+	if res.HasFailures() {
+		return ServeJSON(w, "E_PARTIAL_FAILURE", http.StatusMultiStatus, "some documents couldn't be processed", res, nil, res.Failed)
+	}
+
+	return ServeJSON(w, "", http.StatusOK, "Successful", res, nil, nil)
+}
+
+// getPage returns the page a search request asks for, the presence of the
+// cursor query parameter selects cursor pagination and an empty one starts it
+func getPage(r *http.Request) search.Page {
+	pager := getPager(r)
+	page := search.Page{
+		Skip:  (pager.Page - 1) * pager.Limit,
+		Limit: pager.Limit,
+	}
+	if crsr, ok := r.URL.Query()["cursor"]; ok {
+		page.Cursor = &crsr[0]
+	}
+	page.Highlight, _ = strconv.ParseBool(r.URL.Query().Get("highlight"))
+	page.IncludeHidden = includeHidden(r)
+
+	return page
+}
+
+// searchResults returns the documents of hs, or hs itself with the
+// highlighted fragments of every document when page asks for them
+func searchResults[T any](hs []*search.Highlighted[T], page search.Page) interface{} {
+	if page.Highlight {
+		return hs
+	}
+
+	docs := make([]*T, 0, len(hs))
+	for _, h := range hs {
+		docs = append(docs, h.Doc)
+	}
+
+	return docs
+}
+
+// serveSearchPage serves a page of search results along with the total
+// count and the cursor of the next page
+func serveSearchPage(w http.ResponseWriter, data interface{}, info search.PageInfo) error {
+	resp := &Response{
+		Status:     http.StatusOK,
+		Message:    "Successful",
+		Data:       data,
+		Count:      &info.Total,
+		NextCursor: info.NextCursor,
+	}
+
+	return resp.ServeJSON(w)
+}
+
+// serveSearchError serves the error a search failed with
+func serveSearchError(w http.ResponseWriter, err error) error {
+	if errors.Is(err, search.ErrInvalidCursor) {
+		return ServeJSON(w, "E_INVALID_CURSOR", http.StatusBadRequest, err.Error(), nil, nil, nil)
+	}
+
+	return ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+}
@@ -1,21 +1,57 @@
 package rest
 
 import (
+	"context"
 	"net/http"
-
-	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"strconv"
 )
 
-// APIKeyOnly protects apis by api key
-func APIKeyOnly(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cnf := config.GetApp()
-		apiKey := r.Header.Get("X-API-KEY")
-		if apiKey != cnf.APIKey {
-			ServeJSON(w, "UnAuthorized", http.StatusForbidden, "missing auth token", nil, nil, nil)
-			return
-		}
+// APIKeyOnly protects apis by api key, the X-API-KEY header must hold an
+// active key of ks granting scope
+func APIKeyOnly(ks *KeyStore, scope Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := r.Header.Get("X-API-KEY")
+			if apiKey == "" {
+				ServeJSON(w, "UnAuthorized", http.StatusUnauthorized, "missing api key", nil, nil, nil)
+				return
+			}
+
+			name, ok := ks.Authenticate(apiKey, scope)
+			if name == "" {
+				ServeJSON(w, "UnAuthorized", http.StatusUnauthorized, "invalid api key", nil, nil, nil)
+				return
+			}
+			if !ok {
+				ServeJSON(w, "Forbidden", http.StatusForbidden, "api key lacks "+string(scope)+" scope", nil, nil, nil)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ctxKeyAPIKeyName, name)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// IncludeHiddenAdminOnly lets only admin api keys search with include_hidden,
+// which lifts the visibility rules hiding inactive products and unapproved
+// shops. Requests without it pass unauthenticated.
+func IncludeHiddenAdminOnly(ks *KeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		admin := APIKeyOnly(ks, ScopeAdmin)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if includeHidden(r) {
+				admin.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-		next.ServeHTTP(w, r)
-	})
+// includeHidden reports whether r asks to lift the visibility rules
+func includeHidden(r *http.Request) bool {
+	hidden, _ := strconv.ParseBool(r.URL.Query().Get("include_hidden"))
+	return hidden
 }
@@ -0,0 +1,132 @@
+package rest_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/config"
+	"github.com/BackAged/go-elasticsearch-react/backend/rest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("APIKeyOnly", func() {
+	var (
+		ks   *rest.KeyStore
+		hndl http.Handler
+	)
+
+	serve := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/bulk-insert", nil)
+		if key != "" {
+			req.Header.Set("X-API-KEY", key)
+		}
+		rec := httptest.NewRecorder()
+		hndl.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		var err error
+		ks, err = rest.NewKeyStore([]config.APIKey{
+			{Name: "catalog", Key: "catalog-key", Scopes: []string{"write"}},
+			{Name: "frontend", Key: "frontend-key", Scopes: []string{"read"}},
+			{Name: "ops", Key: "ops-key", Scopes: []string{"admin"}},
+			{Name: "catalog", Key: "retired-key", Scopes: []string{"write"}, ExpiresAt: time.Now().Add(-time.Minute)},
+			// sha256 of hashed-key
+			{Name: "pim", KeySHA256: "a4ae87b73fa5645e6aee415a6f72be4dcbd99d057a7b40cb1b867c181d179260", Scopes: []string{"write"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		hndl = rest.APIKeyOnly(ks, rest.ScopeWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(rest.APIKeyName(r.Context())).ToNot(BeEmpty())
+			w.WriteHeader(http.StatusOK)
+		}))
+	})
+
+	It("rejects missing and unknown keys", func() {
+		Expect(serve("")).To(Equal(http.StatusUnauthorized))
+		Expect(serve("unknown-key")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects expired keys", func() {
+		Expect(serve("retired-key")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("forbids keys without the scope", func() {
+		Expect(serve("frontend-key")).To(Equal(http.StatusForbidden))
+	})
+
+	It("allows keys with the scope or admin", func() {
+		Expect(serve("catalog-key")).To(Equal(http.StatusOK))
+		Expect(serve("ops-key")).To(Equal(http.StatusOK))
+	})
+
+	It("matches keys by their sha256 digest", func() {
+		Expect(serve("hashed-key")).To(Equal(http.StatusOK))
+		Expect(serve("ok")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("rejects an invalid digest", func() {
+		err := ks.Replace([]config.APIKey{
+			{Name: "pim", KeySHA256: "not-hex", Scopes: []string{"write"}},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rotates keys without a restart", func() {
+		err := ks.Replace([]config.APIKey{
+			{Name: "catalog", Key: "rotated-key", Scopes: []string{"write"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(serve("catalog-key")).To(Equal(http.StatusUnauthorized))
+		Expect(serve("rotated-key")).To(Equal(http.StatusOK))
+	})
+
+	It("keeps the current keys when the new ones are invalid", func() {
+		err := ks.Replace([]config.APIKey{
+			{Name: "catalog", Key: "rotated-key", Scopes: []string{"delete-everything"}},
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(serve("catalog-key")).To(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("IncludeHiddenAdminOnly", func() {
+	var hndl http.Handler
+
+	serve := func(target string, key string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if key != "" {
+			req.Header.Set("X-API-KEY", key)
+		}
+		rec := httptest.NewRecorder()
+		hndl.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		ks, err := rest.NewKeyStore([]config.APIKey{
+			{Name: "frontend", Key: "frontend-key", Scopes: []string{"read"}},
+			{Name: "ops", Key: "ops-key", Scopes: []string{"admin"}},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		hndl = rest.IncludeHiddenAdminOnly(ks)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+	})
+
+	It("lets searches within the visibility rules pass without a key", func() {
+		Expect(serve("/?term=tv", "")).To(Equal(http.StatusOK))
+		Expect(serve("/?term=tv&include_hidden=false", "")).To(Equal(http.StatusOK))
+	})
+
+	It("lets only admin keys include hidden documents", func() {
+		Expect(serve("/?term=tv&include_hidden=true", "")).To(Equal(http.StatusUnauthorized))
+		Expect(serve("/?term=tv&include_hidden=true", "frontend-key")).To(Equal(http.StatusForbidden))
+		Expect(serve("/?term=tv&include_hidden=true", "ops-key")).To(Equal(http.StatusOK))
+	})
+})
@@ -2,23 +2,35 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"strconv"
+	"sort"
 
 	"github.com/BackAged/go-elasticsearch-react/backend/search"
 	"github.com/go-chi/chi"
 )
 
+// bounds of the price histogram, an interval below minPriceInterval, one
+// without a price range or one splitting the price range into more than
+// maxPriceBuckets buckets is rejected
+const (
+	minPriceInterval = 1
+	maxPriceBuckets  = 100
+)
+
 // ProductHandler defines product handler
 type ProductHandler struct {
 	svc search.Service
+	ks  *KeyStore
 }
 
 // NewProductHandler ...
-func NewProductHandler(svc search.Service) *ProductHandler {
+func NewProductHandler(svc search.Service, ks *KeyStore) *ProductHandler {
 	return &ProductHandler{
 		svc: svc,
+		ks:  ks,
 	}
 }
 
@@ -26,12 +38,15 @@ func NewProductHandler(svc search.Service) *ProductHandler {
 func (h *ProductHandler) Router() http.Handler {
 	router := chi.NewRouter()
 
-	router.Get("/", h.SearchAsYouTypeProduct)
-	router.Post("/bulk-insert", h.AddProducts)
-	router.Post("/bulk-delete", h.DeleteProducts)
-	router.Post("/bulk-update", h.UpdateProducts)
-	router.Post("/search", h.SearchFacet)
-	router.Post("/update-score", h.UpdateProductScore)
+	router.With(IncludeHiddenAdminOnly(h.ks)).Get("/", h.SearchAsYouTypeProduct)
+	router.With(IncludeHiddenAdminOnly(h.ks)).Post("/search", h.SearchFacet)
+	router.Group(func(r chi.Router) {
+		r.Use(APIKeyOnly(h.ks, ScopeWrite))
+		r.Post("/bulk-insert", h.AddProducts)
+		r.Post("/bulk-delete", h.DeleteProducts)
+		r.Post("/bulk-update", h.UpdateProducts)
+		r.Get("/cascades/{taskID}", h.CascadeStatus)
+	})
 
 	return router
 }
@@ -39,18 +54,16 @@ func (h *ProductHandler) Router() http.Handler {
 // SearchAsYouTypeProduct ...
 func (h *ProductHandler) SearchAsYouTypeProduct(w http.ResponseWriter, r *http.Request) {
 	term := r.URL.Query().Get("term")
-	pager := getPager(r)
-	skip := (pager.Page - 1) * pager.Limit
-	limit := pager.Limit
+	page := getPage(r)
 
-	prds, total, err := h.svc.SearchProductAsType(r.Context(), term, skip, limit)
+	prds, info, err := h.svc.SearchProductAsType(r.Context(), term, page)
 	if err != nil {
 		log.Println("productHandler.SearchAsYouTypeProduct =>  service error: ", err)
-		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+		serveSearchError(w, err)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", prds, &total, nil)
+	serveSearchPage(w, searchResults(prds, page), info)
 	return
 }
 
@@ -69,14 +82,14 @@ func (h *ProductHandler) AddProducts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prds, err = h.svc.AddProducts(r.Context(), prds)
+	res, err := h.svc.AddProducts(r.Context(), prds)
 	if err != nil {
 		log.Println("productHandler.AddProducts =>  service error: ", err)
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", prds, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
 
@@ -100,14 +113,14 @@ func (h *ProductHandler) DeleteProducts(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.svc.DeleteProducts(r.Context(), dbrq.ShopItemIDS)
+	res, err := h.svc.DeleteProducts(r.Context(), dbrq.ShopItemIDS)
 	if err != nil {
 		log.Println("productHandler.DeleteProducts =>  service error: ", err)
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", nil, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
 
@@ -126,50 +139,57 @@ func (h *ProductHandler) UpdateProducts(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	prds, err = h.svc.UpdateProducts(r.Context(), prds)
+	res, err := h.svc.UpdateProducts(r.Context(), prds)
 	if err != nil {
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", prds, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
 
-// UpdateProductScore ...
-func (h *ProductHandler) UpdateProductScore(w http.ResponseWriter, r *http.Request) {
-	shpItmID := r.URL.Query().Get("shop_item_id")
-	shpItmIDINT, err := strconv.ParseInt(shpItmID, 10, 64)
-	if err != nil {
-		log.Println("productHandler.UpdateProductScore =>  invalid shop item id: ", err)
-		ServeJSON(w, "", http.StatusBadRequest, "invalid shop item id", nil, nil, nil)
+// CascadeStatus serves the progress of a shop or brand change being
+// cascaded into the products, tasks are listed by the bulk update results
+func (h *ProductHandler) CascadeStatus(w http.ResponseWriter, r *http.Request) {
+	task, err := h.svc.CascadeStatus(r.Context(), chi.URLParam(r, "taskID"))
+	if errors.Is(err, search.ErrTaskNotFound) {
+		ServeJSON(w, "E_NOT_FOUND", http.StatusNotFound, err.Error(), nil, nil, nil)
 		return
 	}
-
-	err = h.svc.UpdateProductScore(r.Context(), shpItmIDINT)
 	if err != nil {
-		log.Println("productHandler.UpdateProductScore =>  service error: ", err)
+		log.Println("productHandler.CascadeStatus =>  service error: ", err)
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", nil, nil, nil)
+	ServeJSON(w, "", http.StatusOK, "Successful", task, nil, nil)
 	return
 }
 
 type reqFacetSearchProduct struct {
-	Term            string         `json:"term"`
-	BrandFilters    []string       `json:"brand_filters"`
-	ShopFilters     []string       `json:"shop_filters"`
-	CategoryFilters []string       `json:"category_filters"`
-	ColorFilters    []string       `json:"color_filters"`
-	BucketSize      int            `json:"bucket_size"`
-	Sort            []*search.Sort `json:"sort"`
+	Term            string          `json:"term"`
+	BrandFilters    []string        `json:"brand_filters"`
+	ShopFilters     []string        `json:"shop_filters"`
+	CategoryFilters []string        `json:"category_filters"`
+	CategoryPath    []string        `json:"category_path"`
+	ColorFilters    []string        `json:"color_filters"`
+	MinPrice        *float64        `json:"min_price"`
+	MaxPrice        *float64        `json:"max_price"`
+	PriceInterval   float64         `json:"price_interval"`
+	PriceRanges     []float64       `json:"price_ranges"`
+	BucketSize      int             `json:"bucket_size"`
+	Sort            search.SortMode `json:"sort"`
+	Cursor          *string         `json:"cursor"`
+	AutoCorrect     bool            `json:"auto_correct"`
+	Highlight       bool            `json:"highlight"`
 }
 
 type searchFacetRes struct {
-	Products []*search.Product `json:"products"`
-	Facet    *search.FacetRes  `json:"facets"`
+	Products      interface{}         `json:"products"`
+	Facet         *search.FacetRes    `json:"facets"`
+	Suggestions   []search.Suggestion `json:"suggestions"`
+	CorrectedTerm string              `json:"corrected_term,omitempty"`
 }
 
 // SearchFacet ...
@@ -180,36 +200,82 @@ func (h *ProductHandler) SearchFacet(w http.ResponseWriter, r *http.Request) {
 		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "Invalid input", nil, nil, nil)
 		return
 	}
+	if rs.MinPrice != nil && rs.MaxPrice != nil && *rs.MinPrice > *rs.MaxPrice {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "min_price must not exceed max_price", nil, nil, nil)
+		return
+	}
+	if rs.PriceInterval < 0 || (rs.PriceInterval > 0 && rs.PriceInterval < minPriceInterval) {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, fmt.Sprintf("price_interval must be at least %d", minPriceInterval), nil, nil, nil)
+		return
+	}
+	if rs.PriceInterval > 0 && (rs.MinPrice == nil || rs.MaxPrice == nil) {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "price_interval needs min_price and max_price", nil, nil, nil)
+		return
+	}
+	if rs.PriceInterval > 0 && (*rs.MaxPrice-*rs.MinPrice)/rs.PriceInterval > maxPriceBuckets {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, fmt.Sprintf("price_interval splits the price range into more than %d buckets", maxPriceBuckets), nil, nil, nil)
+		return
+	}
+	if !sort.Float64sAreSorted(rs.PriceRanges) {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "price_ranges must be ascending", nil, nil, nil)
+		return
+	}
+	if len(rs.PriceRanges) > maxPriceBuckets {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, fmt.Sprintf("price_ranges holds more than %d bounds", maxPriceBuckets), nil, nil, nil)
+		return
+	}
+	if rs.Sort == "" {
+		rs.Sort = search.SortRelevance
+	}
+	if !rs.Sort.Valid() {
+		ServeJSON(w, "E_INVALID_SORT", http.StatusBadRequest, "unsupported sort", nil, nil, []invalidArg{{
+			Field:   "sort",
+			Value:   rs.Sort,
+			Allowed: search.SortModes(),
+		}})
+		return
+	}
 
-	pager := getPager(r)
-	skip := (pager.Page - 1) * pager.Limit
-	limit := pager.Limit
+	page := getPage(r)
+	if rs.Cursor != nil {
+		page.Cursor = rs.Cursor
+	}
+	if rs.Highlight {
+		page.Highlight = true
+	}
 
 	req := search.FacetSearchReq{
 		Term:            rs.Term,
 		BrandFilters:    rs.BrandFilters,
 		BucketSize:      int(rs.BucketSize),
 		CategoryFilters: rs.CategoryFilters,
+		CategoryPath:    rs.CategoryPath,
 		ColorFilters:    rs.ColorFilters,
-		From:            skip,
+		MinPrice:        rs.MinPrice,
+		MaxPrice:        rs.MaxPrice,
+		PriceInterval:   rs.PriceInterval,
+		PriceRanges:     rs.PriceRanges,
+		Page:            page,
 		ShopFilters:     rs.ShopFilters,
-		Size:            limit,
 		Sort:            rs.Sort,
+		AutoCorrect:     rs.AutoCorrect,
 	}
 
-	prods, fcts, total, err := h.svc.FacetSearchProducts(r.Context(), req)
+	fres, info, err := h.svc.FacetSearchProducts(r.Context(), req)
 	if err != nil {
 		log.Println("productHandler.SearchFacet =>  service error: ", err)
-		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
+		serveSearchError(w, err)
 		return
 	}
 
 	res := &searchFacetRes{
-		Products: prods,
-		Facet:    fcts,
+		Products:      searchResults(fres.Products, page),
+		Facet:         fres.Facets,
+		Suggestions:   fres.Suggestions,
+		CorrectedTerm: fres.CorrectedTerm,
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", res, &total, nil)
+	serveSearchPage(w, res, info)
 	return
 
 }
@@ -0,0 +1,59 @@
+package rest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/rest"
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeService records the facet searches it serves
+type fakeService struct {
+	search.Service
+	reqs []search.FacetSearchReq
+}
+
+func (s *fakeService) FacetSearchProducts(ctx context.Context, req search.FacetSearchReq) (*search.FacetSearchRes, search.PageInfo, error) {
+	s.reqs = append(s.reqs, req)
+	return &search.FacetSearchRes{Products: []*search.Highlighted[search.Product]{}, Facets: &search.FacetRes{}}, search.PageInfo{}, nil
+}
+
+var _ = Describe("SearchFacet", func() {
+	var (
+		svc  *fakeService
+		hndl http.Handler
+	)
+
+	serve := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		hndl.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		svc = &fakeService{}
+		hndl = rest.NewProductHandler(svc, nil).Router()
+	})
+
+	It("buckets prices by a bounded interval", func() {
+		Expect(serve(`{"term": "tv", "price_interval": 500, "min_price": 0, "max_price": 50000}`)).To(Equal(http.StatusOK))
+		Expect(serve(`{"term": "tv", "price_interval": 500, "min_price": 1000, "max_price": 1000}`)).To(Equal(http.StatusOK))
+		Expect(svc.reqs).To(HaveLen(2))
+		Expect(svc.reqs[0].PriceInterval).To(Equal(500.0))
+	})
+
+	It("rejects intervals making too many buckets", func() {
+		Expect(serve(`{"term": "tv", "price_interval": -1}`)).To(Equal(http.StatusBadRequest))
+		Expect(serve(`{"term": "tv", "price_interval": 0.0001}`)).To(Equal(http.StatusBadRequest))
+		Expect(serve(`{"term": "tv", "price_interval": 10, "min_price": 0, "max_price": 50000}`)).To(Equal(http.StatusBadRequest))
+		Expect(serve(`{"term": "tv", "price_interval": 1}`)).To(Equal(http.StatusBadRequest))
+		Expect(serve(`{"term": "tv", "price_interval": 1, "min_price": 0}`)).To(Equal(http.StatusBadRequest))
+		Expect(svc.reqs).To(BeEmpty())
+	})
+})
@@ -12,12 +12,14 @@ import (
 // ShopHandler defines shop handler
 type ShopHandler struct {
 	svc search.Service
+	ks  *KeyStore
 }
 
 // NewShopHandler ...
-func NewShopHandler(svc search.Service) *ShopHandler {
+func NewShopHandler(svc search.Service, ks *KeyStore) *ShopHandler {
 	return &ShopHandler{
 		svc: svc,
+		ks:  ks,
 	}
 }
 
@@ -25,10 +27,13 @@ func NewShopHandler(svc search.Service) *ShopHandler {
 func (h *ShopHandler) Router() http.Handler {
 	router := chi.NewRouter()
 
-	router.Get("/", h.SearchAsYouTypeShop)
-	router.Post("/bulk-insert", h.AddShops)
-	router.Post("/bulk-delete", h.DeleteShops)
-	router.Post("/bulk-update", h.UpdateShops)
+	router.With(IncludeHiddenAdminOnly(h.ks)).Get("/", h.SearchAsYouTypeShop)
+	router.Group(func(r chi.Router) {
+		r.Use(APIKeyOnly(h.ks, ScopeWrite))
+		r.Post("/bulk-insert", h.AddShops)
+		r.Post("/bulk-delete", h.DeleteShops)
+		r.Post("/bulk-update", h.UpdateShops)
+	})
 
 	return router
 }
@@ -36,17 +41,16 @@ func (h *ShopHandler) Router() http.Handler {
 // SearchAsYouTypeShop ...
 func (h *ShopHandler) SearchAsYouTypeShop(w http.ResponseWriter, r *http.Request) {
 	term := r.URL.Query().Get("term")
-	pager := getPager(r)
-	skip := (pager.Page - 1) * pager.Limit
-	limit := pager.Limit
+	page := getPage(r)
 
-	brnds, total, err := h.svc.SearchShopAsType(r.Context(), term, skip, limit)
+	brnds, info, err := h.svc.SearchShopAsType(r.Context(), term, page)
 	if err != nil {
-		ServeJSON(w, "", http.StatusOK, "Successful", nil, nil, nil)
+		log.Println("shopHandler.SearchAsYouTypeShop =>  service error: ", err)
+		serveSearchError(w, err)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", brnds, &total, nil)
+	serveSearchPage(w, searchResults(brnds, page), info)
 	return
 }
 
@@ -65,13 +69,13 @@ func (h *ShopHandler) AddShops(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	brnds, err = h.svc.AddShops(r.Context(), brnds)
+	res, err := h.svc.AddShops(r.Context(), brnds)
 	if err != nil {
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", brnds, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
 
@@ -95,13 +99,13 @@ func (h *ShopHandler) DeleteShops(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.svc.DeleteShops(r.Context(), dbrq.IDS)
+	res, err := h.svc.DeleteShops(r.Context(), dbrq.IDS)
 	if err != nil {
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", nil, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
 
@@ -120,12 +124,12 @@ func (h *ShopHandler) UpdateShops(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shps, err = h.svc.UpdateShops(r.Context(), shps)
+	res, err := h.svc.UpdateShops(r.Context(), shps)
 	if err != nil {
 		ServeJSON(w, "", http.StatusInternalServerError, "Something went wrong!", nil, nil, nil)
 		return
 	}
 
-	ServeJSON(w, "", http.StatusOK, "Successful", shps, nil, nil)
+	serveBulkResult(w, res)
 	return
 }
@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/go-chi/chi"
+)
+
+// suggestion limits of a group, when the request sets none and at most
+const (
+	defaultSuggestLimit = 5
+	maxSuggestLimit     = 20
+)
+
+// SuggestHandler defines autocomplete handler
+type SuggestHandler struct {
+	svc search.Service
+	ks  *KeyStore
+}
+
+// NewSuggestHandler ...
+func NewSuggestHandler(svc search.Service, ks *KeyStore) *SuggestHandler {
+	return &SuggestHandler{
+		svc: svc,
+		ks:  ks,
+	}
+}
+
+// Router ..
+func (h *SuggestHandler) Router() http.Handler {
+	router := chi.NewRouter()
+
+	router.With(IncludeHiddenAdminOnly(h.ks)).Get("/", h.Suggest)
+
+	return router
+}
+
+// Suggest serves brand, shop, category and product suggestions for term.
+// limit caps every group, <group>_limit (i.e. brands_limit) caps a single
+// one and a limit of 0 leaves the group out.
+func (h *SuggestHandler) Suggest(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	term := q.Get("term")
+	if term == "" {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "term is required", nil, nil, nil)
+		return
+	}
+
+	limit, ok := suggestLimit(q.Get("limit"), defaultSuggestLimit)
+	if !ok {
+		ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "invalid limit", nil, nil, []invalidArg{{
+			Field: "limit",
+			Value: q.Get("limit"),
+		}})
+		return
+	}
+
+	req := search.SuggestReq{
+		Term:          term,
+		Limits:        map[search.SuggestGroup]int{},
+		IncludeHidden: includeHidden(r),
+	}
+	for _, g := range search.SuggestGroups() {
+		field := string(g) + "_limit"
+		l, ok := suggestLimit(q.Get(field), limit)
+		if !ok {
+			ServeJSON(w, "E_INVALID_ARG", http.StatusBadRequest, "invalid "+field, nil, nil, []invalidArg{{
+				Field: field,
+				Value: q.Get(field),
+			}})
+			return
+		}
+		req.Limits[g] = l
+	}
+
+	res, err := h.svc.Suggest(r.Context(), req)
+	if err != nil {
+		log.Println("suggestHandler.Suggest =>  service error: ", err)
+		serveSearchError(w, err)
+		return
+	}
+
+	ServeJSON(w, "", http.StatusOK, "Successful", res, nil, nil)
+	return
+}
+
+// suggestLimit parses the limit l, def when it is empty, capped at maxSuggestLimit
+func suggestLimit(l string, def int) (int, bool) {
+	if l == "" {
+		return def, true
+	}
+
+	li, err := strconv.Atoi(l)
+	if err != nil || li < 0 {
+		return 0, false
+	}
+	if li > maxSuggestLimit {
+		li = maxSuggestLimit
+	}
+
+	return li, true
+}
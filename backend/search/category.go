@@ -0,0 +1,14 @@
+package search
+
+// Category defines Category type, ParentID is zero for root categories and
+// Path holds the category names from the root down to the category itself
+type Category struct {
+	ID       int64    `json:"id"`
+	Version  int64    `json:"version"`
+	Slug     string   `json:"slug"`
+	Name     string   `json:"name"`
+	ParentID int64    `json:"parent_id"`
+	Path     []string `json:"path"`
+	Level    int32    `json:"level"`
+	ImageURL string   `json:"image_url"`
+}
@@ -0,0 +1,230 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// EventType defines the kind of engagement a click stream event records
+type EventType string
+
+// event types
+const (
+	EventView      EventType = "view"
+	EventClick     EventType = "click"
+	EventAddToCart EventType = "add_to_cart"
+)
+
+// ClickStream defines an engagement event of a shopper on a product
+type ClickStream struct {
+	// EventID identifies the event, a resent event is counted once
+	EventID    string    `json:"event_id"`
+	ShopItemID int64     `json:"shop_item_id"`
+	Event      EventType `json:"event"`
+	At         time.Time `json:"at"`
+}
+
+// popularityLandmark is the fixed point in time popularity decays from,
+// moving it requires recomputing every popularity
+var popularityLandmark = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// TrackerConfig defines how engagement turns into popularity
+type TrackerConfig struct {
+	// Weights is the popularity an event adds at the time it happens
+	Weights map[EventType]float64
+	// HalfLife is the age at which an event counts half as much as a new one
+	HalfLife time.Duration
+	// FlushInterval is how often pending popularity is written
+	FlushInterval time.Duration
+	// MaxPending flushes early once as many products have pending popularity
+	MaxPending int
+	// DedupWindow is how long an event id is remembered, an event resent
+	// within it is ignored
+	DedupWindow time.Duration
+}
+
+// DefaultEventWeights weighs an event by the intent it shows
+var DefaultEventWeights = map[EventType]float64{
+	EventView:      1,
+	EventClick:     3,
+	EventAddToCart: 10,
+}
+
+// Tracker buffers click stream events, aggregates them per product and
+// periodically adds the resulting popularity to the products.
+//
+// Popularity uses forward decay: an event adds weight * 2^(age of the event
+// relative to the landmark / half life). Scores of products that see no new
+// engagement never have to be rewritten, newer events simply add more, so
+// recent engagement outranks old clicks. That sum outgrows a float64 within
+// about a thousand half lives, so popularity is kept as its log2 and events
+// are added by AddLog2.
+type Tracker struct {
+	repo    PopularityRepo
+	cnf     TrackerConfig
+	now     func() time.Time
+	mu      sync.Mutex
+	pending map[int64]float64
+	// seen holds when the event ids of the dedup window were tracked
+	seen    map[string]time.Time
+	flushCh chan struct{}
+}
+
+// NewTracker returns a tracker adding popularity through repo
+func NewTracker(repo PopularityRepo, cnf TrackerConfig) *Tracker {
+	if cnf.Weights == nil {
+		cnf.Weights = DefaultEventWeights
+	}
+	if cnf.HalfLife <= 0 {
+		cnf.HalfLife = 7 * 24 * time.Hour
+	}
+	if cnf.FlushInterval <= 0 {
+		cnf.FlushInterval = 10 * time.Second
+	}
+	if cnf.DedupWindow <= 0 {
+		cnf.DedupWindow = time.Hour
+	}
+
+	return &Tracker{
+		repo:    repo,
+		cnf:     cnf,
+		now:     time.Now,
+		pending: map[int64]float64{},
+		seen:    map[string]time.Time{},
+		flushCh: make(chan struct{}, 1),
+	}
+}
+
+// Track validates and buffers events, events without a time happened now
+// and events already tracked within the dedup window are ignored
+func (t *Tracker) Track(events ...*ClickStream) error {
+	now := t.now()
+	for i, e := range events {
+		if e.EventID == "" {
+			return fmt.Errorf("event #%d: %w: missing event_id", i, ErrInvalidEvent)
+		}
+		if e.ShopItemID <= 0 {
+			return fmt.Errorf("event #%d: %w: missing shop_item_id", i, ErrInvalidEvent)
+		}
+		if _, ok := t.cnf.Weights[e.Event]; !ok {
+			return fmt.Errorf("event #%d: %w: unknown event %q", i, ErrInvalidEvent, e.Event)
+		}
+	}
+
+	t.mu.Lock()
+	for _, e := range events {
+		if at, ok := t.seen[e.EventID]; ok && now.Sub(at) < t.cnf.DedupWindow {
+			continue
+		}
+		t.seen[e.EventID] = now
+
+		// log2 of no popularity is -Inf, which elasticsearch can't take
+		if t.cnf.Weights[e.Event] <= 0 {
+			continue
+		}
+		at := e.At
+		if at.IsZero() || at.After(now) {
+			at = now
+		}
+		t.add(e.ShopItemID, t.score(e.Event, at))
+	}
+	full := t.cnf.MaxPending > 0 && len(t.pending) >= t.cnf.MaxPending
+	t.mu.Unlock()
+
+	if full {
+		select {
+		case t.flushCh <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// score is the log2 of the popularity event adds when it happened at
+func (t *Tracker) score(event EventType, at time.Time) float64 {
+	return math.Log2(t.cnf.Weights[event]) + at.Sub(popularityLandmark).Hours()/t.cnf.HalfLife.Hours()
+}
+
+// add adds the log2 popularity score to the pending popularity of id, t.mu
+// must be held
+func (t *Tracker) add(id int64, score float64) {
+	if p, ok := t.pending[id]; ok {
+		score = AddLog2(p, score)
+	}
+	t.pending[id] = score
+}
+
+// AddLog2 returns log2(2^a + 2^b) without computing 2^a or 2^b, which
+// overflow for the log2 popularity of today
+func AddLog2(a float64, b float64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+
+	return a + math.Log2(1+math.Exp2(b-a))
+}
+
+// Flush writes the pending popularity, it is kept for the next flush
+// when writing fails as a whole. Event ids older than the dedup window are
+// forgotten.
+func (t *Tracker) Flush(ctx context.Context) error {
+	now := t.now()
+	t.mu.Lock()
+	scores := t.pending
+	t.pending = map[int64]float64{}
+	for id, at := range t.seen {
+		if now.Sub(at) >= t.cnf.DedupWindow {
+			delete(t.seen, id)
+		}
+	}
+	t.mu.Unlock()
+
+	if len(scores) == 0 {
+		return nil
+	}
+
+	res, err := t.repo.AddPopularity(ctx, scores)
+	if err != nil {
+		t.mu.Lock()
+		for id, s := range scores {
+			t.add(id, s)
+		}
+		t.mu.Unlock()
+		return err
+	}
+	if res.HasFailures() {
+		log.Printf("tracker.Flush: dropped popularity of %d products: %v\n", len(res.Failed), res.Failed)
+	}
+
+	return nil
+}
+
+// Run flushes every FlushInterval and whenever MaxPending is reached,
+// until ctx is done and a last flush is made
+func (t *Tracker) Run(ctx context.Context) {
+	tckr := time.NewTicker(t.cnf.FlushInterval)
+	defer tckr.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fctx, cancel := context.WithTimeout(context.Background(), t.cnf.FlushInterval)
+			if err := t.Flush(fctx); err != nil {
+				log.Println("tracker.Run: error on last flush, popularity is lost: ", err)
+			}
+			cancel()
+			return
+		case <-tckr.C:
+		case <-t.flushCh:
+		}
+
+		if err := t.Flush(ctx); err != nil {
+			log.Println("tracker.Run: error flushing, retrying on next flush: ", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakePopularityRepo struct {
+	err    error
+	scores []map[int64]float64
+}
+
+func (r *fakePopularityRepo) AddPopularity(ctx context.Context, scores map[int64]float64) (*BulkResult, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.scores = append(r.scores, scores)
+
+	return &BulkResult{}, nil
+}
+
+var _ = Describe("Tracker", func() {
+	var (
+		repo  *fakePopularityRepo
+		trckr *Tracker
+		now   time.Time
+	)
+
+	BeforeEach(func() {
+		repo = &fakePopularityRepo{}
+		trckr = NewTracker(repo, TrackerConfig{HalfLife: 24 * time.Hour})
+		now = popularityLandmark.Add(48 * time.Hour)
+		trckr.now = func() time.Time { return now }
+	})
+
+	It("aggregates events per product with decay", func() {
+		Expect(trckr.Track(
+			&ClickStream{EventID: "e1", ShopItemID: 1, Event: EventClick},
+			&ClickStream{EventID: "e2", ShopItemID: 1, Event: EventView, At: now.Add(-24 * time.Hour)},
+			&ClickStream{EventID: "e3", ShopItemID: 2, Event: EventAddToCart},
+		)).To(Succeed())
+
+		Expect(trckr.Flush(context.Background())).To(Succeed())
+		Expect(repo.scores).To(HaveLen(1))
+		Expect(repo.scores[0]).To(HaveLen(2))
+		Expect(repo.scores[0][1]).To(BeNumerically("~", math.Log2(3*4+1*2), 1e-9))
+		Expect(repo.scores[0][2]).To(BeNumerically("~", math.Log2(10*4), 1e-9))
+	})
+
+	It("keeps the popularity of today finite with a short half life", func() {
+		trckr = NewTracker(repo, TrackerConfig{HalfLife: time.Hour})
+		now = time.Now()
+		trckr.now = func() time.Time { return now }
+
+		Expect(trckr.Track(
+			&ClickStream{EventID: "e4", ShopItemID: 1, Event: EventView},
+			&ClickStream{EventID: "e5", ShopItemID: 1, Event: EventView},
+			&ClickStream{EventID: "e6", ShopItemID: 1, Event: EventView, At: now.Add(-time.Hour)},
+		)).To(Succeed())
+		Expect(trckr.Flush(context.Background())).To(Succeed())
+
+		// two views now and a view counting half as much, 2.5 views of now
+		score := repo.scores[0][1]
+		Expect(math.IsInf(score, 0) || math.IsNaN(score)).To(BeFalse())
+		Expect(score).To(BeNumerically("~", now.Sub(popularityLandmark).Hours()+math.Log2(2.5), 1e-6))
+	})
+
+	It("adds popularity in log2 without overflowing", func() {
+		Expect(AddLog2(3, 3)).To(Equal(4.0))
+		Expect(AddLog2(2000, 1)).To(Equal(2000.0))
+		Expect(AddLog2(1, 2000)).To(Equal(2000.0))
+	})
+
+	It("rejects unknown events", func() {
+		err := trckr.Track(&ClickStream{EventID: "e7", ShopItemID: 1, Event: "like"})
+		Expect(errors.Is(err, ErrInvalidEvent)).To(BeTrue())
+	})
+
+	It("counts a resent event once within the dedup window", func() {
+		Expect(trckr.Track(
+			&ClickStream{EventID: "a", ShopItemID: 1, Event: EventView},
+			&ClickStream{EventID: "a", ShopItemID: 1, Event: EventView},
+		)).To(Succeed())
+		Expect(trckr.Track(&ClickStream{EventID: "a", ShopItemID: 1, Event: EventView})).To(Succeed())
+		Expect(trckr.Flush(context.Background())).To(Succeed())
+		Expect(repo.scores).To(Equal([]map[int64]float64{{1: math.Log2(4)}}))
+
+		now = now.Add(time.Hour)
+		Expect(trckr.Flush(context.Background())).To(Succeed())
+		Expect(trckr.seen).To(BeEmpty())
+	})
+
+	It("rejects events without an id", func() {
+		err := trckr.Track(&ClickStream{ShopItemID: 1, Event: EventView})
+		Expect(errors.Is(err, ErrInvalidEvent)).To(BeTrue())
+	})
+
+	It("keeps pending popularity when flushing fails", func() {
+		Expect(trckr.Track(&ClickStream{EventID: "e8", ShopItemID: 1, Event: EventView})).To(Succeed())
+
+		repo.err = errors.New("es down")
+		Expect(trckr.Flush(context.Background())).ToNot(Succeed())
+
+		Expect(trckr.Track(&ClickStream{EventID: "e9", ShopItemID: 1, Event: EventView})).To(Succeed())
+		repo.err = nil
+		Expect(trckr.Flush(context.Background())).To(Succeed())
+		Expect(repo.scores).To(Equal([]map[int64]float64{{1: math.Log2(4 + 4)}}))
+	})
+})
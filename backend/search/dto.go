@@ -1,34 +1,170 @@
 package search
 
-// Sort defines sort criteria
-type Sort struct {
-	FieldName string `json:"field_name"`
-	Order     string `json:"order"`
+// SortMode names a supported ordering of facet search results
+type SortMode string
+
+// sort modes
+const (
+	SortRelevance SortMode = "relevance"
+	SortPriceAsc  SortMode = "price_asc"
+	SortPriceDesc SortMode = "price_desc"
+	SortNewest    SortMode = "newest"
+	SortPopular   SortMode = "popular"
+	SortDiscount  SortMode = "discount"
+)
+
+// SortModes returns every supported sort mode
+func SortModes() []SortMode {
+	return []SortMode{
+		SortRelevance, SortPriceAsc, SortPriceDesc, SortNewest, SortPopular, SortDiscount,
+	}
+}
+
+// Valid reports whether m is a supported sort mode
+func (m SortMode) Valid() bool {
+	for _, sm := range SortModes() {
+		if m == sm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Page selects a page of search results by offset, or when Cursor is set
+// by cursor. An empty cursor starts a new cursor pagination, a cursor taken
+// from the PageInfo of a page continues after that page. Highlight asks for
+// the matched fragments of every result, IncludeHidden lifts the visibility
+// rules so inactive products and unapproved shops are found too.
+type Page struct {
+	Skip          int64
+	Limit         int64
+	Cursor        *string
+	Highlight     bool
+	IncludeHidden bool
+}
+
+// PageInfo describes a page of search results, NextCursor is empty when
+// paginating by offset and on the last page
+type PageInfo struct {
+	Total      int64
+	NextCursor string
 }
 
 // FacetSearchReq defines dto of facet search
 type FacetSearchReq struct {
 	Term            string
-	From            int64
-	Size            int64
+	Page            Page
 	BucketSize      int
 	CategoryFilters []string
+	CategoryPath    []string
 	BrandFilters    []string
 	ShopFilters     []string
 	ColorFilters    []string
-	Sort            []*Sort
+	// MinPrice and MaxPrice bound the effective price, nil is unbounded
+	MinPrice *float64
+	MaxPrice *float64
+	// PriceInterval buckets the price facet between MinPrice and MaxPrice
+	// into a histogram, when it is zero PriceRanges holds the ascending
+	// bounds of the buckets instead
+	PriceInterval float64
+	PriceRanges   []float64
+	Sort          SortMode
+	// AutoCorrect reruns the search with the top suggestion when the term
+	// matches nothing on the first page
+	AutoCorrect bool
+}
+
+// Suggestion is a spelling correction of the search term, Highlighted is
+// Text with the corrected words wrapped in <em>
+type Suggestion struct {
+	Text        string  `json:"text"`
+	Highlighted string  `json:"highlighted"`
+	Score       float64 `json:"score"`
+}
+
+// FacetSearchRes defines facet search result. CorrectedTerm is set when the
+// term matched nothing and the products and facets are those of the top
+// suggestion instead, further pages are searched with CorrectedTerm.
+type FacetSearchRes struct {
+	Products      []*Highlighted[Product]
+	Facets        *FacetRes
+	Suggestions   []Suggestion
+	CorrectedTerm string
 }
 
 // Bucket ...
 type Bucket struct {
-	Key      string `json:"key" mapstructure:"key"`
-	DocCount int32  `json:"doc_count" mapstructure:"doc_count"`
+	Key      string `json:"key"`
+	DocCount int64  `json:"doc_count"`
+}
+
+// CategoryBucket is a bucket of the category tree facet, Path is the full
+// path down to the category and Children holds the level below it
+type CategoryBucket struct {
+	Key      string           `json:"key"`
+	Path     []string         `json:"path"`
+	DocCount int64            `json:"doc_count"`
+	Children []CategoryBucket `json:"children,omitempty"`
+}
+
+// PriceBucket is a bucket of the price facet, a nil From or To is unbounded
+type PriceBucket struct {
+	From     *float64 `json:"from"`
+	To       *float64 `json:"to"`
+	DocCount int64    `json:"doc_count"`
+}
+
+// PriceFacet holds the price distribution of a facet search, Min and Max
+// are the lowest and highest effective price regardless of the buckets
+type PriceFacet struct {
+	Min     float64       `json:"min"`
+	Max     float64       `json:"max"`
+	Buckets []PriceBucket `json:"buckets"`
 }
 
 // FacetRes facet response
 type FacetRes struct {
-	Brands     []Bucket `json:"brands"`
-	Categories []Bucket `json:"categories"`
-	Shops      []Bucket `json:"shops"`
-	Colors     []Bucket `json:"colors"`
+	Brands       []Bucket         `json:"brands"`
+	Categories   []Bucket         `json:"categories"`
+	CategoryTree []CategoryBucket `json:"category_tree"`
+	Shops        []Bucket         `json:"shops"`
+	Colors       []Bucket         `json:"colors"`
+	Prices       *PriceFacet      `json:"prices"`
+}
+
+// BulkItemFailure defines a document elasticsearch rejected in a bulk request
+type BulkItemFailure struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// BulkResult reports the per document outcome of a bulk request.
+// Skipped holds documents elasticsearch left untouched, i.e. updates
+// carrying a stale version and deletes of missing documents. Tasks are the
+// elasticsearch tasks cascading the changes into the products.
+type BulkResult struct {
+	Succeeded []string          `json:"succeeded"`
+	Skipped   []string          `json:"skipped"`
+	Failed    []BulkItemFailure `json:"failed"`
+	Tasks     []string          `json:"tasks,omitempty"`
+}
+
+// HasFailures reports whether any document of the bulk request failed
+func (br *BulkResult) HasFailures() bool {
+	return br != nil && len(br.Failed) > 0
+}
+
+// CascadeTask reports the progress of a shop or brand change being cascaded
+// into the products, Failures holds the reasons of products that failed
+type CascadeTask struct {
+	ID        string   `json:"id"`
+	Completed bool     `json:"completed"`
+	Total     int64    `json:"total"`
+	Updated   int64    `json:"updated"`
+	Noops     int64    `json:"noops"`
+	Conflicts int64    `json:"version_conflicts"`
+	Failures  []string `json:"failures,omitempty"`
 }
@@ -1 +1,12 @@
 package search
+
+import "errors"
+
+// ErrInvalidCursor is returned for a cursor that is malformed or expired
+var ErrInvalidCursor = errors.New("invalid or expired cursor")
+
+// ErrInvalidEvent is returned for a click stream event that can't be tracked
+var ErrInvalidEvent = errors.New("invalid event")
+
+// ErrTaskNotFound is returned for a cascade task elasticsearch doesn't know
+var ErrTaskNotFound = errors.New("task not found")
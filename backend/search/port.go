@@ -4,48 +4,80 @@ import "context"
 
 // ProductRepo defines interface for infra
 type ProductRepo interface {
-	BulkInsert(context.Context, []*Product) ([]*Product, error)
+	BulkInsert(context.Context, []*Product) (*BulkResult, error)
 	Add(context.Context, *Product) (*Product, error)
-	Search(ctx context.Context, term string, skip int64, limit int64) ([]*Product, int64, error)
-	SearchFacet(context.Context, FacetSearchReq) ([]*Product, *FacetRes, int64, error)
-	UpdateProductScore(context.Context, int64) error
-	DeleteMany(ctx context.Context, shopItemIDS []int64) error
-	UpdateMany(ctx context.Context, products []*Product) ([]*Product, error)
+	Search(ctx context.Context, term string, page Page) ([]*Highlighted[Product], PageInfo, error)
+	SearchFacet(context.Context, FacetSearchReq) (*FacetSearchRes, PageInfo, error)
+	DeleteMany(ctx context.Context, shopItemIDS []int64) (*BulkResult, error)
+	UpdateMany(ctx context.Context, products []*Product) (*BulkResult, error)
+	SetShopApproval(ctx context.Context, shops []*Shop, approved bool) error
+	CascadeShop(ctx context.Context, fromSlug string, shop *Shop) (string, error)
+	CascadeBrand(ctx context.Context, fromSlug string, brand *Brand) (string, error)
+	CascadeTask(ctx context.Context, taskID string) (*CascadeTask, error)
+}
+
+// PopularityRepo defines interface for infra, scores are log2 popularity
+// added as AddLog2 does
+type PopularityRepo interface {
+	AddPopularity(ctx context.Context, scores map[int64]float64) (*BulkResult, error)
 }
 
 // BrandRepo defines interface for infra
 type BrandRepo interface {
-	SearchAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Brand, int64, error)
-	BulkInsert(ctx context.Context, brands []*Brand) ([]*Brand, error)
-	DeleteMany(ctx context.Context, brandIDS []int64) error
-	UpdateMany(ctx context.Context, brands []*Brand) ([]*Brand, error)
+	SearchAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Brand], PageInfo, error)
+	BulkInsert(ctx context.Context, brands []*Brand) (*BulkResult, error)
+	DeleteMany(ctx context.Context, brandIDS []int64) (*BulkResult, error)
+	UpdateMany(ctx context.Context, brands []*Brand) (*BulkResult, error)
+	GetMany(ctx context.Context, brandIDS []int64) ([]*Brand, error)
 }
 
 // ShopRepo defines interface for infra
 type ShopRepo interface {
-	SearchAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Shop, int64, error)
-	BulkInsert(ctx context.Context, shops []*Shop) ([]*Shop, error)
-	DeleteMany(ctx context.Context, brandIDS []int64) error
-	UpdateMany(ctx context.Context, shops []*Shop) ([]*Shop, error)
+	SearchAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Shop], PageInfo, error)
+	BulkInsert(ctx context.Context, shops []*Shop) (*BulkResult, error)
+	DeleteMany(ctx context.Context, brandIDS []int64) (*BulkResult, error)
+	UpdateMany(ctx context.Context, shops []*Shop) (*BulkResult, error)
+	Approvals(ctx context.Context, shopSlugs []string) (map[string]bool, error)
+	GetMany(ctx context.Context, shopIDS []int64) ([]*Shop, error)
+}
+
+// CategoryRepo defines interface for infra
+type CategoryRepo interface {
+	SearchAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Category], PageInfo, error)
+	BulkInsert(ctx context.Context, categories []*Category) (*BulkResult, error)
+	DeleteMany(ctx context.Context, categoryIDS []int64) (*BulkResult, error)
+	UpdateMany(ctx context.Context, categories []*Category) (*BulkResult, error)
+}
+
+// SuggestRepo defines interface for infra
+type SuggestRepo interface {
+	Suggest(ctx context.Context, req SuggestReq) (*SuggestRes, error)
 }
 
 // Service provides port for application adapter.
 type Service interface {
 	AddProduct(context.Context, *Product) (*Product, error)
-	AddProducts(context.Context, []*Product) ([]*Product, error)
-	SearchProductAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Product, int64, error)
-	DeleteProducts(ctx context.Context, shopItemIDS []int64) error
-	FacetSearchProducts(context.Context, FacetSearchReq) ([]*Product, *FacetRes, int64, error)
-	UpdateProductScore(context.Context, int64) error
-	UpdateProducts(ctx context.Context, products []*Product) ([]*Product, error)
-
-	SearchShopAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Shop, int64, error)
-	AddShops(ctx context.Context, shops []*Shop) ([]*Shop, error)
-	DeleteShops(ctx context.Context, shopIDS []int64) error
-	UpdateShops(ctx context.Context, shops []*Shop) ([]*Shop, error)
-
-	SearchBrandAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Brand, int64, error)
-	AddBrands(ctx context.Context, brands []*Brand) ([]*Brand, error)
-	DeleteBrands(ctx context.Context, brandIDS []int64) error
-	UpdateBrands(ctx context.Context, brands []*Brand) ([]*Brand, error)
+	AddProducts(context.Context, []*Product) (*BulkResult, error)
+	SearchProductAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Product], PageInfo, error)
+	DeleteProducts(ctx context.Context, shopItemIDS []int64) (*BulkResult, error)
+	FacetSearchProducts(context.Context, FacetSearchReq) (*FacetSearchRes, PageInfo, error)
+	UpdateProducts(ctx context.Context, products []*Product) (*BulkResult, error)
+	CascadeStatus(ctx context.Context, taskID string) (*CascadeTask, error)
+
+	SearchShopAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Shop], PageInfo, error)
+	AddShops(ctx context.Context, shops []*Shop) (*BulkResult, error)
+	DeleteShops(ctx context.Context, shopIDS []int64) (*BulkResult, error)
+	UpdateShops(ctx context.Context, shops []*Shop) (*BulkResult, error)
+
+	SearchBrandAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Brand], PageInfo, error)
+	AddBrands(ctx context.Context, brands []*Brand) (*BulkResult, error)
+	DeleteBrands(ctx context.Context, brandIDS []int64) (*BulkResult, error)
+	UpdateBrands(ctx context.Context, brands []*Brand) (*BulkResult, error)
+
+	SearchCategoryAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Category], PageInfo, error)
+	AddCategories(ctx context.Context, categories []*Category) (*BulkResult, error)
+	DeleteCategories(ctx context.Context, categoryIDS []int64) (*BulkResult, error)
+	UpdateCategories(ctx context.Context, categories []*Category) (*BulkResult, error)
+
+	Suggest(ctx context.Context, req SuggestReq) (*SuggestRes, error)
 }
@@ -1,31 +1,38 @@
 package search
 
+import "time"
+
 // Product defines product type
 type Product struct {
-	ID              int64         `json:"id" mapstructure:"id"`
-	Version         int64         `json:"version" mapstructure:"version"`
-	Slug            string        `json:"slug" mapstructure:"slug"`
-	Name            string        `json:"name" mapstructure:"name"`
-	ShopName        string        `json:"shop_name" mapstructure:"shop_name"`
-	ShopSlug        string        `json:"shop_slug" mapstructure:"shop_slug"`
-	ShopItemID      int64         `json:"shop_item_id,omitempty" mapstructure:"shop_item_id"`
-	Price           float64       `json:"price,omitempty" mapstructure:"price"`
-	DiscountedPrice float64       `json:"discounted_price,omitempty" mapstructure:"discounted_price"`
-	MinPrice        float64       `json:"min_price,omitempty" mapstructure:"min_price"`
-	MaxPrice        float64       `json:"max_price,omitempty" mapstructure:"max_price"`
-	BrandName       string        `json:"brand_name,omitempty" mapstructure:"brand_name"`
-	BrandSlug       string        `json:"brand_slug,omitempty" mapstructure:"brand_slug"`
-	CategoryName    string        `json:"category_name,omitempty" mapstructure:"category_name"`
-	CategorySlug    string        `json:"category_slug,omitempty" mapstructure:"category_slug"`
-	ColorVariants   []string      `json:"color_variants,omitempty" mapstructure:"color_variants"`
-	Color           string        `json:"color,omitempty" mapstructure:"color"`
-	Ranking         float64       `json:"ranking,omitempty" mapstructure:"ranking"`
-	Tags            []string      `json:"tags,omitempty" mapstructure:"tags"`
-	ClickStreams    []ClickStream `json:"click_streams,omitempty"`
-	Status          bool          `json:"status,omitempty" mapstructure:"status"`
-	ProductImage    string        `json:"product_image,omitempty" mapstructure:"product_image"`
-}
-
-type ClickStream struct {
-	//TODO: figure out later
+	ID              int64              `json:"id"`
+	Version         int64              `json:"version"`
+	Slug            string             `json:"slug"`
+	Name            string             `json:"name"`
+	ShopName        string             `json:"shop_name"`
+	ShopSlug        string             `json:"shop_slug"`
+	ShopID          int64              `json:"shop_id,omitempty"`
+	ShopItemID      int64              `json:"shop_item_id,omitempty"`
+	Price           float64            `json:"price,omitempty"`
+	DiscountedPrice float64            `json:"discounted_price,omitempty"`
+	MinPrice        float64            `json:"min_price,omitempty"`
+	MaxPrice        float64            `json:"max_price,omitempty"`
+	BrandName       string             `json:"brand_name,omitempty"`
+	BrandSlug       string             `json:"brand_slug,omitempty"`
+	BrandID         int64              `json:"brand_id,omitempty"`
+	CategoryName    string             `json:"category_name,omitempty"`
+	CategorySlug    string             `json:"category_slug,omitempty"`
+	CategoryPath    []string           `json:"category_path,omitempty"`
+	ColorVariants   []string           `json:"color_variants,omitempty"`
+	Color           string             `json:"color,omitempty"`
+	Ranking         map[string]float64 `json:"ranking,omitempty"`
+	Tags            []string           `json:"tags,omitempty"`
+	// Status is only written when it is sent, so an update without it
+	// leaves the product as active as it was
+	Status *bool `json:"status,omitempty"`
+	// ShopApproved mirrors the approval of the shop, it is kept in sync
+	// by the service and not taken from producers
+	ShopApproved bool   `json:"shop_approved"`
+	ProductImage string `json:"product_image,omitempty"`
+	// CreatedAt is only written when it is sent, so updates leave it alone
+	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
@@ -3,126 +3,395 @@ package search
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
+// Timeouts defines per operation deadlines, zero means no deadline
+// other than the one the caller's context carries
+type Timeouts struct {
+	Search time.Duration
+	Write  time.Duration
+}
+
+// Config defines the tunables of the service
+type Config struct {
+	Timeouts Timeouts
+	// PriceRanges are the default bounds of the price facet buckets,
+	// used when a facet search asks for neither ranges nor an interval
+	PriceRanges []float64
+}
+
 type service struct {
-	prdRepo  ProductRepo
-	brndRepo BrandRepo
-	shpRepo  ShopRepo
+	prdRepo   ProductRepo
+	brndRepo  BrandRepo
+	shpRepo   ShopRepo
+	ctgRepo   CategoryRepo
+	sgstRepo  SuggestRepo
+	tmt       Timeouts
+	prcRanges []float64
 }
 
 // NewService creates a service with the necessary dependencies.
-func NewService(prdRepo ProductRepo, brndRepo BrandRepo, shpRepo ShopRepo) Service {
+func NewService(prdRepo ProductRepo, brndRepo BrandRepo, shpRepo ShopRepo, ctgRepo CategoryRepo, sgstRepo SuggestRepo, cnf Config) Service {
 	return &service{
-		prdRepo:  prdRepo,
-		brndRepo: brndRepo,
-		shpRepo:  shpRepo,
+		prdRepo:   prdRepo,
+		brndRepo:  brndRepo,
+		shpRepo:   shpRepo,
+		ctgRepo:   ctgRepo,
+		sgstRepo:  sgstRepo,
+		tmt:       cnf.Timeouts,
+		prcRanges: cnf.PriceRanges,
+	}
+}
+
+// withTimeout derives a context bounded by d from ctx
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
 	}
+
+	return context.WithTimeout(ctx, d)
 }
 
 /////////////////// Product //////////////////
 func (s *service) AddProduct(ctx context.Context, product *Product) (*Product, error) {
-	prd, err := s.prdRepo.Add(context.Background(), product)
-	fmt.Print(prd)
-	return prd, err
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	if err := s.resolveShopApproval(ctx, []*Product{product}); err != nil {
+		return nil, err
+	}
+
+	return s.prdRepo.Add(ctx, product)
 }
 
-func (s *service) AddProducts(ctx context.Context, products []*Product) ([]*Product, error) {
-	prds, err := s.prdRepo.BulkInsert(context.Background(), products)
-	fmt.Print(prds)
-	return prds, err
+func (s *service) AddProducts(ctx context.Context, products []*Product) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	if err := s.resolveShopApproval(ctx, products); err != nil {
+		return nil, err
+	}
+
+	return s.prdRepo.BulkInsert(ctx, products)
 }
 
-func (s *service) SearchProductAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Product, int64, error) {
-	prds, total, err := s.prdRepo.Search(context.Background(), term, skip, limit)
+func (s *service) SearchProductAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Product], PageInfo, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Search)
+	defer cancel()
+
+	prds, info, err := s.prdRepo.Search(ctx, term, page)
 	if err != nil {
-		return nil, 0, err
+		return nil, PageInfo{}, err
 	}
 
-	return prds, total, err
+	return prds, info, err
 }
 
-func (s *service) DeleteProducts(ctx context.Context, shopItemIDS []int64) error {
-	return s.prdRepo.DeleteMany(context.Background(), shopItemIDS)
+func (s *service) DeleteProducts(ctx context.Context, shopItemIDS []int64) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	return s.prdRepo.DeleteMany(ctx, shopItemIDS)
+}
+
+func (s *service) FacetSearchProducts(ctx context.Context, req FacetSearchReq) (*FacetSearchRes, PageInfo, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Search)
+	defer cancel()
+
+	if req.PriceInterval <= 0 && len(req.PriceRanges) == 0 {
+		req.PriceRanges = s.prcRanges
+	}
+
+	res, info, err := s.prdRepo.SearchFacet(ctx, req)
+	if err != nil || !req.AutoCorrect || info.Total > 0 || len(res.Suggestions) == 0 {
+		return res, info, err
+	}
+	// a continued cursor belongs to the corrected term already
+	if req.Page.Cursor != nil && *req.Page.Cursor != "" {
+		return res, info, nil
+	}
+
+	corrected := req
+	corrected.Term = res.Suggestions[0].Text
+	cres, cinfo, err := s.prdRepo.SearchFacet(ctx, corrected)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	cres.Suggestions = res.Suggestions
+	cres.CorrectedTerm = corrected.Term
+
+	return cres, cinfo, nil
 }
 
-func (s *service) FacetSearchProducts(ctx context.Context, req FacetSearchReq) ([]*Product, *FacetRes, int64, error) {
-	return s.prdRepo.SearchFacet(context.Background(), req)
+func (s *service) UpdateProducts(ctx context.Context, products []*Product) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	if err := s.resolveShopApproval(ctx, products); err != nil {
+		return nil, err
+	}
+
+	return s.prdRepo.UpdateMany(ctx, products)
 }
 
-func (s *service) UpdateProductScore(ctx context.Context, shopItemID int64) error {
-	return s.prdRepo.UpdateProductScore(context.Background(), shopItemID)
+func (s *service) CascadeStatus(ctx context.Context, taskID string) (*CascadeTask, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Search)
+	defer cancel()
+
+	return s.prdRepo.CascadeTask(ctx, taskID)
 }
 
-func (s *service) UpdateProducts(ctx context.Context, products []*Product) ([]*Product, error) {
-	prds, err := s.prdRepo.UpdateMany(context.Background(), products)
+// resolveShopApproval sets the shop approval of products from their shops,
+// looked up by shop id or, for products without one, by shop slug. Products
+// of shops not known yet are hidden until the shop is added.
+func (s *service) resolveShopApproval(ctx context.Context, products []*Product) error {
+	ids, slugs := []int64{}, []string{}
+	seenID, seenSlug := map[int64]bool{}, map[string]bool{}
+	for _, p := range products {
+		if p.ShopID > 0 {
+			if !seenID[p.ShopID] {
+				seenID[p.ShopID] = true
+				ids = append(ids, p.ShopID)
+			}
+		} else if !seenSlug[p.ShopSlug] {
+			seenSlug[p.ShopSlug] = true
+			slugs = append(slugs, p.ShopSlug)
+		}
+	}
+
+	approvedByID := map[int64]bool{}
+	if len(ids) > 0 {
+		shps, err := s.shpRepo.GetMany(ctx, ids)
+		if err != nil {
+			return fmt.Errorf("resolving shop approval: %w", err)
+		}
+		for _, shp := range shps {
+			approvedByID[shp.ID] = shp.Approved()
+		}
+	}
+	approved, err := s.shpRepo.Approvals(ctx, slugs)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("resolving shop approval: %w", err)
+	}
+	for _, p := range products {
+		if p.ShopID > 0 {
+			p.ShopApproved = approvedByID[p.ShopID]
+		} else {
+			p.ShopApproved = approved[p.ShopSlug]
+		}
 	}
 
-	return prds, err
+	return nil
 }
 
 /////////////////// Brand //////////////////
-func (s *service) SearchBrandAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Brand, int64, error) {
-	brnds, total, err := s.brndRepo.SearchAsType(context.Background(), term, skip, limit)
+func (s *service) SearchBrandAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Brand], PageInfo, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Search)
+	defer cancel()
+
+	brnds, info, err := s.brndRepo.SearchAsType(ctx, term, page)
 	if err != nil {
-		return nil, 0, err
+		return nil, PageInfo{}, err
 	}
 
-	return brnds, total, err
+	return brnds, info, err
 }
 
-func (s *service) AddBrands(ctx context.Context, brands []*Brand) ([]*Brand, error) {
-	brnds, err := s.brndRepo.BulkInsert(context.Background(), brands)
+func (s *service) AddBrands(ctx context.Context, brands []*Brand) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	return s.brndRepo.BulkInsert(ctx, brands)
+}
+
+func (s *service) UpdateBrands(ctx context.Context, brands []*Brand) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	ids := make([]int64, 0, len(brands))
+	for _, b := range brands {
+		ids = append(ids, b.ID)
+	}
+	prev, err := s.brndRepo.GetMany(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
+	prevByID := make(map[int64]*Brand, len(prev))
+	for _, b := range prev {
+		prevByID[b.ID] = b
+	}
 
-	return brnds, err
-}
+	// renames are cascaded before the brands are written, a retry after a
+	// failed cascade still sees them renamed
+	tasks := []string{}
+	for _, b := range brands {
+		old, ok := prevByID[b.ID]
+		if !ok || b.Version <= old.Version || (old.Slug == b.Slug && old.Name == b.Name) {
+			continue
+		}
+
+		task, err := s.prdRepo.CascadeBrand(ctx, old.Slug, b)
+		if err != nil {
+			return nil, fmt.Errorf("cascading brand %d: %w", b.ID, err)
+		}
+		tasks = append(tasks, task)
+	}
 
-func (s *service) UpdateBrands(ctx context.Context, brands []*Brand) ([]*Brand, error) {
-	brnds, err := s.brndRepo.UpdateMany(context.Background(), brands)
+	res, err := s.brndRepo.UpdateMany(ctx, brands)
 	if err != nil {
 		return nil, err
 	}
+	res.Tasks = tasks
 
-	return brnds, err
+	return res, nil
 }
 
-func (s *service) DeleteBrands(ctx context.Context, brandIDS []int64) error {
-	return s.brndRepo.DeleteMany(context.Background(), brandIDS)
+func (s *service) DeleteBrands(ctx context.Context, brandIDS []int64) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	return s.brndRepo.DeleteMany(ctx, brandIDS)
 }
 
 /////////////////// Shop //////////////////
-func (s *service) SearchShopAsType(ctx context.Context, term string, skip int64, limit int64) ([]*Shop, int64, error) {
-	shps, total, err := s.shpRepo.SearchAsType(context.Background(), term, skip, limit)
+func (s *service) SearchShopAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Shop], PageInfo, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Search)
+	defer cancel()
+
+	shps, info, err := s.shpRepo.SearchAsType(ctx, term, page)
 	if err != nil {
-		return nil, 0, err
+		return nil, PageInfo{}, err
 	}
 
-	return shps, total, err
+	return shps, info, err
 }
 
-func (s *service) AddShops(ctx context.Context, shops []*Shop) ([]*Shop, error) {
-	brnds, err := s.shpRepo.BulkInsert(context.Background(), shops)
-	if err != nil {
+func (s *service) AddShops(ctx context.Context, shops []*Shop) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	if _, err := s.cascadeShops(ctx, shops, nil); err != nil {
 		return nil, err
 	}
 
-	return brnds, err
+	return s.shpRepo.BulkInsert(ctx, shops)
 }
 
-func (s *service) DeleteShops(ctx context.Context, shopIDS []int64) error {
-	return s.shpRepo.DeleteMany(context.Background(), shopIDS)
+func (s *service) DeleteShops(ctx context.Context, shopIDS []int64) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	return s.shpRepo.DeleteMany(ctx, shopIDS)
 }
 
-func (s *service) UpdateShops(ctx context.Context, shops []*Shop) ([]*Shop, error) {
-	shps, err := s.shpRepo.UpdateMany(context.Background(), shops)
+func (s *service) UpdateShops(ctx context.Context, shops []*Shop) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	ids := make([]int64, 0, len(shops))
+	for _, shp := range shops {
+		ids = append(ids, shp.ID)
+	}
+	prev, err := s.shpRepo.GetMany(ctx, ids)
 	if err != nil {
 		return nil, err
 	}
 
-	return shps, err
+	tasks, err := s.cascadeShops(ctx, shops, prev)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.shpRepo.UpdateMany(ctx, shops)
+	if err != nil {
+		return nil, err
+	}
+	res.Tasks = tasks
+
+	return res, nil
+}
+
+// cascadeShops cascades shops into their products before they are written,
+// a retry after a failed cascade still sees the change. Shops older than
+// their version in prev are left out. Renamed shops, those whose name or
+// slug differ from prev, are cascaded by a task also carrying the approval
+// and its id is returned, only the approval of the others is cascaded.
+func (s *service) cascadeShops(ctx context.Context, shops []*Shop, prev []*Shop) ([]string, error) {
+	prevByID := make(map[int64]*Shop, len(prev))
+	for _, shp := range prev {
+		prevByID[shp.ID] = shp
+	}
+
+	tasks := []string{}
+	approval := map[bool][]*Shop{}
+	for _, shp := range shops {
+		old, ok := prevByID[shp.ID]
+		if ok && shp.Version <= old.Version {
+			continue
+		}
+		if !ok || (old.Slug == shp.Slug && old.ShopName == shp.ShopName) {
+			approval[shp.Approved()] = append(approval[shp.Approved()], shp)
+			continue
+		}
+
+		task, err := s.prdRepo.CascadeShop(ctx, old.Slug, shp)
+		if err != nil {
+			return nil, fmt.Errorf("cascading shop %d: %w", shp.ID, err)
+		}
+		tasks = append(tasks, task)
+	}
+
+	for _, approved := range []bool{true, false} {
+		if len(approval[approved]) == 0 {
+			continue
+		}
+		if err := s.prdRepo.SetShopApproval(ctx, approval[approved], approved); err != nil {
+			return nil, fmt.Errorf("cascading shop approval: %w", err)
+		}
+	}
+
+	return tasks, nil
+}
+
+/////////////////// Category //////////////////
+func (s *service) SearchCategoryAsType(ctx context.Context, term string, page Page) ([]*Highlighted[Category], PageInfo, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Search)
+	defer cancel()
+
+	ctgrs, info, err := s.ctgRepo.SearchAsType(ctx, term, page)
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	return ctgrs, info, err
+}
+
+func (s *service) AddCategories(ctx context.Context, categories []*Category) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	return s.ctgRepo.BulkInsert(ctx, categories)
+}
+
+func (s *service) DeleteCategories(ctx context.Context, categoryIDS []int64) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	return s.ctgRepo.DeleteMany(ctx, categoryIDS)
+}
+
+func (s *service) UpdateCategories(ctx context.Context, categories []*Category) (*BulkResult, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Write)
+	defer cancel()
+
+	return s.ctgRepo.UpdateMany(ctx, categories)
+}
+
+/////////////////// Suggest //////////////////
+func (s *service) Suggest(ctx context.Context, req SuggestReq) (*SuggestRes, error) {
+	ctx, cancel := withTimeout(ctx, s.tmt.Search)
+	defer cancel()
+
+	return s.sgstRepo.Suggest(ctx, req)
 }
@@ -0,0 +1,204 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeProductRepo struct {
+	ProductRepo
+	found    map[string][]*Highlighted[Product]
+	terms    []string
+	approved map[string]bool
+	renamed  map[string]string
+}
+
+func (r *fakeProductRepo) CascadeShop(ctx context.Context, fromSlug string, shop *Shop) (string, error) {
+	r.renamed[fromSlug] = shop.Slug
+
+	return "node:" + fromSlug, nil
+}
+
+func (r *fakeProductRepo) SetShopApproval(ctx context.Context, shops []*Shop, approved bool) error {
+	for _, s := range shops {
+		r.approved[s.Slug] = approved
+	}
+
+	return nil
+}
+
+type fakeShopRepo struct {
+	ShopRepo
+	approved map[string]bool
+	prev     []*Shop
+}
+
+func (r *fakeShopRepo) GetMany(ctx context.Context, ids []int64) ([]*Shop, error) {
+	return r.prev, nil
+}
+
+func (r *fakeShopRepo) UpdateMany(ctx context.Context, shops []*Shop) (*BulkResult, error) {
+	return &BulkResult{Succeeded: []string{"1", "2"}, Skipped: []string{"3"}}, nil
+}
+
+func (r *fakeShopRepo) Approvals(ctx context.Context, shopSlugs []string) (map[string]bool, error) {
+	return r.approved, nil
+}
+
+func (r *fakeProductRepo) SearchFacet(ctx context.Context, req FacetSearchReq) (*FacetSearchRes, PageInfo, error) {
+	r.terms = append(r.terms, req.Term)
+	prds := r.found[req.Term]
+
+	return &FacetSearchRes{
+		Products:    prds,
+		Facets:      &FacetRes{},
+		Suggestions: []Suggestion{{Text: "nike shoes", Highlighted: "<em>nike</em> shoes"}},
+	}, PageInfo{Total: int64(len(prds))}, nil
+}
+
+var _ = Describe("FacetSearchProducts", func() {
+	var (
+		repo *fakeProductRepo
+		svc  Service
+	)
+
+	BeforeEach(func() {
+		repo = &fakeProductRepo{found: map[string][]*Highlighted[Product]{"nike shoes": {{Doc: &Product{ID: 1}}}}}
+		svc = NewService(repo, nil, nil, nil, nil, Config{})
+	})
+
+	It("reruns a term matching nothing with the top suggestion", func() {
+		res, info, err := svc.FacetSearchProducts(context.Background(), FacetSearchReq{Term: "nikee shoes", AutoCorrect: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.terms).To(Equal([]string{"nikee shoes", "nike shoes"}))
+		Expect(res.CorrectedTerm).To(Equal("nike shoes"))
+		Expect(res.Products).To(HaveLen(1))
+		Expect(res.Suggestions).To(HaveLen(1))
+		Expect(info.Total).To(Equal(int64(1)))
+	})
+
+	It("only suggests without auto correct", func() {
+		res, _, err := svc.FacetSearchProducts(context.Background(), FacetSearchReq{Term: "nikee shoes"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.terms).To(Equal([]string{"nikee shoes"}))
+		Expect(res.CorrectedTerm).To(BeEmpty())
+		Expect(res.Suggestions[0].Text).To(Equal("nike shoes"))
+	})
+})
+
+var _ = Describe("Shop approval", func() {
+	var (
+		prdRepo *fakeProductRepo
+		shpRepo *fakeShopRepo
+		svc     Service
+	)
+
+	BeforeEach(func() {
+		prdRepo = &fakeProductRepo{approved: map[string]bool{}, renamed: map[string]string{}}
+		shpRepo = &fakeShopRepo{approved: map[string]bool{"walton": true}, prev: []*Shop{
+			{ID: 1, Slug: "walton", Approval: ShopApproved, Version: 1},
+			{ID: 2, Slug: "rfl", Version: 1},
+			{ID: 3, Slug: "stale", Version: 5},
+			{ID: 4, Slug: "pran", ShopName: "Pran", Version: 1},
+		}}
+		svc = NewService(prdRepo, nil, shpRepo, nil, nil, Config{})
+	})
+
+	It("cascades the approval of the shops updated to their products", func() {
+		_, err := svc.UpdateShops(context.Background(), []*Shop{
+			{ID: 1, Slug: "walton", Approval: ShopApproved, Version: 2},
+			{ID: 2, Slug: "rfl", Version: 2},
+			{ID: 3, Slug: "stale", Approval: ShopApproved, Version: 4},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(prdRepo.approved).To(Equal(map[string]bool{"walton": true, "rfl": false}))
+		Expect(prdRepo.renamed).To(BeEmpty())
+	})
+
+	It("cascades renamed shops into their products as tasks", func() {
+		res, err := svc.UpdateShops(context.Background(), []*Shop{
+			{ID: 4, Slug: "pran-rfl", ShopName: "Pran RFL", Version: 2},
+			{ID: 3, Slug: "renamed-stale", Version: 4},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Tasks).To(Equal([]string{"node:pran"}))
+		Expect(prdRepo.renamed).To(Equal(map[string]string{"pran": "pran-rfl"}))
+		Expect(prdRepo.approved).To(BeEmpty())
+	})
+
+	It("resolves the shop approval of products from their shops", func() {
+		prds := []*Product{{ShopSlug: "walton"}, {ShopSlug: "unknown"}, {ShopID: 1, ShopSlug: "walton-old"}, {ShopID: 2, ShopSlug: "walton"}}
+		Expect(svc.(*service).resolveShopApproval(context.Background(), prds)).To(Succeed())
+		Expect(prds[0].ShopApproved).To(BeTrue())
+		Expect(prds[1].ShopApproved).To(BeFalse())
+		// products with a shop id are resolved by it, whatever their slug
+		Expect(prds[2].ShopApproved).To(BeTrue())
+		Expect(prds[3].ShopApproved).To(BeFalse())
+	})
+})
+
+// deadlineProductRepo records the deadlines the repo calls get
+type deadlineProductRepo struct {
+	ProductRepo
+	deadlines []time.Time
+}
+
+func (r *deadlineProductRepo) record(ctx context.Context) {
+	if d, ok := ctx.Deadline(); ok {
+		r.deadlines = append(r.deadlines, d)
+	}
+}
+
+func (r *deadlineProductRepo) Search(ctx context.Context, term string, page Page) ([]*Highlighted[Product], PageInfo, error) {
+	r.record(ctx)
+	return nil, PageInfo{}, nil
+}
+
+func (r *deadlineProductRepo) DeleteMany(ctx context.Context, shopItemIDS []int64) (*BulkResult, error) {
+	r.record(ctx)
+	return &BulkResult{}, nil
+}
+
+var _ = Describe("Timeouts", func() {
+	var repo *deadlineProductRepo
+
+	BeforeEach(func() {
+		repo = &deadlineProductRepo{}
+	})
+
+	It("bounds the repo calls by the deadline of their operation", func() {
+		svc := NewService(repo, nil, nil, nil, nil, Config{Timeouts: Timeouts{Search: time.Second, Write: time.Hour}})
+
+		start := time.Now()
+		_, _, err := svc.SearchProductAsType(context.Background(), "nike", Page{})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = svc.DeleteProducts(context.Background(), []int64{1})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(repo.deadlines).To(HaveLen(2))
+		Expect(repo.deadlines[0]).To(BeTemporally("~", start.Add(time.Second), 100*time.Millisecond))
+		Expect(repo.deadlines[1]).To(BeTemporally("~", start.Add(time.Hour), 100*time.Millisecond))
+	})
+
+	It("keeps a shorter deadline of the caller", func() {
+		svc := NewService(repo, nil, nil, nil, nil, Config{Timeouts: Timeouts{Search: time.Hour}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		want, _ := ctx.Deadline()
+		_, _, err := svc.SearchProductAsType(ctx, "nike", Page{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.deadlines).To(Equal([]time.Time{want}))
+	})
+
+	It("sets no deadline without a timeout", func() {
+		svc := NewService(repo, nil, nil, nil, nil, Config{})
+
+		_, err := svc.DeleteProducts(context.Background(), []int64{1})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repo.deadlines).To(BeEmpty())
+	})
+})
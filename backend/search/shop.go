@@ -1,14 +1,22 @@
 package search
 
+// ShopApproved is the approval of a shop whose products shoppers see
+const ShopApproved int32 = 1
+
 // Shop defines Shop type
 type Shop struct {
-	ID             int64  `json:"id" mapstructure:"id"`
-	Version        int64  `json:"version" mapstructure:"version"`
-	Slug           string `json:"slug" mapstructure:"slug"`
-	Approval       int32  `json:"approval" mapstructure:"approval"`
-	ContatctNumber string `json:"contact_number" mapstructure:"contact_number"`
-	OwnerName      string `json:"owner_name" mapstructure:"owner_name"`
-	OwnerNumber    string `json:"owner_number" mapstructure:"owner_number"`
-	ShopImage      string `json:"shop_image" mapstructure:"shop_image"`
-	ShopName       string `json:"shop_name" mapstructure:"shop_name"`
+	ID             int64  `json:"id"`
+	Version        int64  `json:"version"`
+	Slug           string `json:"slug"`
+	Approval       int32  `json:"approval"`
+	ContatctNumber string `json:"contact_number"`
+	OwnerName      string `json:"owner_name"`
+	OwnerNumber    string `json:"owner_number"`
+	ShopImage      string `json:"shop_image"`
+	ShopName       string `json:"shop_name"`
+}
+
+// Approved reports whether shoppers see the shop and its products
+func (s *Shop) Approved() bool {
+	return s.Approval == ShopApproved
 }
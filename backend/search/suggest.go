@@ -0,0 +1,41 @@
+package search
+
+// SuggestGroup names an entity autocomplete suggestions are grouped by
+type SuggestGroup string
+
+// suggest groups
+const (
+	SuggestBrands     SuggestGroup = "brands"
+	SuggestShops      SuggestGroup = "shops"
+	SuggestCategories SuggestGroup = "categories"
+	SuggestProducts   SuggestGroup = "products"
+)
+
+// SuggestGroups returns every suggest group
+func SuggestGroups() []SuggestGroup {
+	return []SuggestGroup{SuggestBrands, SuggestShops, SuggestCategories, SuggestProducts}
+}
+
+// SuggestReq defines dto of autocomplete, Limits caps the suggestions of
+// each group and groups without a limit are left out. IncludeHidden lifts
+// the visibility rules like it does for a Page.
+type SuggestReq struct {
+	Term          string
+	Limits        map[SuggestGroup]int
+	IncludeHidden bool
+}
+
+// Highlighted is a search result along with the fragments of its fields
+// that matched, keyed by field with the matches wrapped in <em>
+type Highlighted[T any] struct {
+	Doc       *T                  `json:"doc"`
+	Highlight map[string][]string `json:"highlight"`
+}
+
+// SuggestRes holds autocomplete suggestions grouped by entity
+type SuggestRes struct {
+	Brands     []*Highlighted[Brand]    `json:"brands"`
+	Shops      []*Highlighted[Shop]     `json:"shops"`
+	Categories []*Highlighted[Category] `json:"categories"`
+	Products   []*Highlighted[Product]  `json:"products"`
+}
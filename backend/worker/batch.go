@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	"github.com/streadway/amqp"
+)
+
+// BatchConfig defines when the documents of the messages batched for a
+// task are written, whichever comes first
+type BatchConfig struct {
+	// MaxDocs writes a batch once it holds as many documents
+	MaxDocs int
+	// Window writes the documents batched so far every window
+	Window time.Duration
+}
+
+// Enabled reports whether messages are batched at all
+func (c BatchConfig) Enabled() bool {
+	return c.MaxDocs > 1 && c.Window > 0
+}
+
+// BatchTaskFunc writes the documents of several messages in one call and
+// returns the error of every document, by index, nil when it was written.
+// An error fails every document.
+type BatchTaskFunc func(ctx context.Context, docs []json.RawMessage) ([]error, error)
+
+// batchedMsg is a message waiting in a batch and its documents
+type batchedMsg struct {
+	msg  amqp.Delivery
+	docs []json.RawMessage
+}
+
+// batcher merges the messages of a task into batches, messages are acked
+// or retried once their batch is written
+type batcher struct {
+	w    *Worker
+	task string
+	fn   BatchTaskFunc
+	cnf  BatchConfig
+
+	mu      sync.Mutex
+	pending []batchedMsg
+	ndocs   int
+	// writing is held while a batch is written, so a flush returns only
+	// once the batches taken before it are written too
+	writing sync.Mutex
+}
+
+// RegisterBatchTask registers a task batching its messages as cnf defines,
+// it is used over the task registered by RegisterTask
+func (w *Worker) RegisterBatchTask(task string, fn BatchTaskFunc, cnf BatchConfig) error {
+	if _, ok := w.batchers[task]; ok {
+		log.Printf("batch task-%s already registered!!\n", task)
+		return NewErrAlreadyRegisteredTask(task)
+	}
+
+	w.batchers[task] = &batcher{w: w, task: task, fn: fn, cnf: cnf}
+	return nil
+}
+
+// add batches the documents of payload, the payload of msg, the batch is
+// written right away once it is full. A payload that isn't a list of
+// documents is dead lettered.
+func (b *batcher) add(msg amqp.Delivery, payload json.RawMessage) error {
+	var docs []json.RawMessage
+	if err := json.Unmarshal(payload, &docs); err != nil {
+		fmt.Println("worker.batcher couldn't unmarshal msg payload", err)
+		return b.w.deadLetter(b.w.taskCtx, msg, err)
+	}
+	if len(docs) == 0 {
+		return msg.Ack(false)
+	}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, batchedMsg{msg: msg, docs: docs})
+	b.ndocs += len(docs)
+	full := b.ndocs >= b.cnf.MaxDocs
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+
+	return nil
+}
+
+// run writes the batch every window until consumed is closed, and a last
+// time then
+func (b *batcher) run(consumed <-chan struct{}) {
+	tckr := time.NewTicker(b.cnf.Window)
+	defer tckr.Stop()
+
+	for {
+		select {
+		case <-consumed:
+			b.flush()
+			return
+		case <-tckr.C:
+			b.flush()
+		}
+	}
+}
+
+// flush writes the documents batched so far in one call, acks the messages
+// whose documents were all written, dead letters the ones with a document
+// that can't be decoded and retries the others
+func (b *batcher) flush() {
+	b.writing.Lock()
+	defer b.writing.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending, b.ndocs = nil, 0
+	b.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	docs := []json.RawMessage{}
+	for _, m := range batch {
+		docs = append(docs, m.docs...)
+	}
+
+	ctx, cancel := b.w.taskCtx, context.CancelFunc(func() {})
+	if b.w.taskTimeout > 0 {
+		ctx, cancel = context.WithTimeout(b.w.taskCtx, b.w.taskTimeout)
+	}
+	errs, err := b.fn(ctx, docs)
+	cancel()
+	log.Printf("task-%s wrote a batch of %d messages, %d documents\n", b.task, len(batch), len(docs))
+
+	start := 0
+	for _, m := range batch {
+		merr, invalid := err, false
+		if merr == nil {
+			merr = docErrors(errs, start, len(m.docs))
+			invalid = invalidDocs(errs, start, len(m.docs))
+		}
+		start += len(m.docs)
+
+		if invalid {
+			b.w.deadLetter(b.w.taskCtx, m.msg, merr)
+			continue
+		}
+		if merr != nil {
+			b.w.retry(b.w.taskCtx, m.msg, merr)
+			continue
+		}
+		if aerr := m.msg.Ack(false); aerr != nil {
+			log.Printf("task-%s couldn't ack message: %s\n", b.task, aerr)
+		}
+	}
+}
+
+// flushEntity writes the batches of the entity of task, i.e. of every
+// catalog.product.* task for catalog.product.delete
+func (w *Worker) flushEntity(task string) {
+	entity := task[:strings.LastIndex(task, ".")+1]
+	for t, b := range w.batchers {
+		if strings.HasPrefix(t, entity) {
+			b.flush()
+		}
+	}
+}
+
+// docErrors joins the errors of the n documents from start, nil when all
+// of them were written
+func docErrors(errs []error, start int, n int) error {
+	msgs := []string{}
+	for i := start; i < start+n && i < len(errs); i++ {
+		if errs[i] != nil {
+			msgs = append(msgs, errs[i].Error())
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// invalidDocs reports whether any of the n documents from start can't be
+// decoded
+func invalidDocs(errs []error, start int, n int) bool {
+	for i := start; i < start+n && i < len(errs); i++ {
+		if errors.Is(errs[i], ErrInvalidDocument) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeBatch unmarshals docs and writes them with write, the error of a
+// document is either an ErrInvalidDocument or the bulk failure of its id
+func writeBatch[T any](ctx context.Context, task string, docs []json.RawMessage, docID func(*T) int64, write func(context.Context, []*T) (*search.BulkResult, error)) ([]error, error) {
+	errs := make([]error, len(docs))
+	items := make([]*T, 0, len(docs))
+	idxs := make([]int, 0, len(docs))
+	for i, d := range docs {
+		item := new(T)
+		if err := json.Unmarshal(d, item); err != nil {
+			errs[i] = fmt.Errorf("%w: %s", ErrInvalidDocument, err)
+			continue
+		}
+		items = append(items, item)
+		idxs = append(idxs, i)
+	}
+	if len(items) == 0 {
+		return errs, nil
+	}
+
+	res, err := write(ctx, items)
+	if err != nil {
+		fmt.Printf("worker.%s service error: %s\n", task, err)
+		return nil, err
+	}
+	if len(res.Tasks) > 0 {
+		log.Printf("worker.%s cascading renames into products as tasks: %v\n", task, res.Tasks)
+	}
+	if !res.HasFailures() {
+		return errs, nil
+	}
+
+	fmt.Printf("worker.%s documents failed: %v\n", task, res.Failed)
+	failed := map[string]search.BulkItemFailure{}
+	for _, f := range res.Failed {
+		failed[f.ID] = f
+	}
+	for j, item := range items {
+		if f, ok := failed[strconv.FormatInt(docID(item), 10)]; ok {
+			errs[idxs[j]] = fmt.Errorf("document %s failed: %s: %s", f.ID, f.Type, f.Reason)
+		}
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/streadway/amqp"
+)
+
+var _ = Describe("Batch", func() {
+	var (
+		w      *Worker
+		dly    *fakePublisher
+		dlq    *fakePublisher
+		writes [][]*search.Product
+	)
+
+	// updateProducts fails the product with shop item id 2
+	updateProducts := func(ctx context.Context, prds []*search.Product) (*search.BulkResult, error) {
+		writes = append(writes, prds)
+		res := &search.BulkResult{}
+		for _, p := range prds {
+			if p.ShopItemID == 2 {
+				res.Failed = append(res.Failed, search.BulkItemFailure{ID: "2", Status: 429, Type: "es_rejected_execution_exception"})
+			}
+		}
+		return res, nil
+	}
+
+	msg := func(ack *fakeAcknowledger, body string) amqp.Delivery {
+		return amqp.Delivery{Acknowledger: ack, RoutingKey: RoutingKeyProductUpdate, Body: []byte(body)}
+	}
+
+	BeforeEach(func() {
+		dly, dlq, writes = &fakePublisher{}, &fakePublisher{}, nil
+		w = NewWorker(1, 0, nil, Retry{Policy: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second}, Queue: "search", Delay: dly, DeadLetter: dlq})
+		Expect(w.RegisterBatchTask(RoutingKeyProductUpdate, func(ctx context.Context, docs []json.RawMessage) ([]error, error) {
+			return writeBatch(ctx, "UpdateProductsBatch", docs, productID, updateProducts)
+		}, BatchConfig{MaxDocs: 3, Window: time.Hour})).To(Succeed())
+	})
+
+	It("writes the messages of a full batch in one call and acks them by their documents", func() {
+		ok, failed := &fakeAcknowledger{}, &fakeAcknowledger{}
+		Expect(w.reduce(context.Background(), msg(ok, `[{"shop_item_id": 1}]`))).To(Succeed())
+		Expect(writes).To(BeEmpty())
+		Expect(w.reduce(context.Background(), msg(failed, `[{"shop_item_id": 2}, {"shop_item_id": 3}]`))).To(Succeed())
+
+		Expect(writes).To(HaveLen(1))
+		Expect(writes[0]).To(HaveLen(3))
+		Expect(ok.acked).To(BeTrue())
+		Expect(failed.acked).To(BeTrue())
+		Expect(dly.keys).To(HaveLen(1))
+		Expect(dly.headers[0][HeaderError]).To(ContainSubstring("document 2 failed"))
+	})
+
+	It("retries every message of a batch failing as a whole", func() {
+		b := w.batchers[RoutingKeyProductUpdate]
+		b.fn = func(ctx context.Context, docs []json.RawMessage) ([]error, error) {
+			return nil, errors.New("es down")
+		}
+		ack := &fakeAcknowledger{}
+		Expect(w.reduce(context.Background(), msg(ack, `[{"shop_item_id": 1}]`))).To(Succeed())
+		b.flush()
+
+		Expect(dly.keys).To(HaveLen(1))
+		Expect(ack.acked).To(BeTrue())
+	})
+
+	It("dead letters the messages with a document that can't be decoded", func() {
+		ok, invalid := &fakeAcknowledger{}, &fakeAcknowledger{}
+		Expect(w.reduce(context.Background(), msg(ok, `[{"shop_item_id": 1}]`))).To(Succeed())
+		Expect(w.reduce(context.Background(), msg(invalid, `[{"shop_item_id": 2, "price": "cheap"}, {"shop_item_id": 3}]`))).To(Succeed())
+
+		Expect(writes).To(HaveLen(1))
+		Expect(writes[0]).To(HaveLen(2))
+		Expect(ok.acked).To(BeTrue())
+		Expect(invalid.acked).To(BeTrue())
+		Expect(dly.keys).To(BeEmpty())
+		Expect(dlq.keys).To(HaveLen(1))
+		Expect(dlq.headers[0][HeaderError]).To(Equal("invalid document: json: cannot unmarshal string into Go struct field Product.price of type float64"))
+	})
+
+	It("dead letters a payload that isn't a list of documents", func() {
+		ack := &fakeAcknowledger{}
+		Expect(w.reduce(context.Background(), msg(ack, `{"shop_item_id": 1}`))).To(Succeed())
+
+		Expect(w.batchers[RoutingKeyProductUpdate].pending).To(BeEmpty())
+		Expect(ack.acked).To(BeTrue())
+		Expect(dly.keys).To(BeEmpty())
+		Expect(dlq.keys).To(HaveLen(1))
+	})
+
+	It("writes the batched creates and updates of an entity before a delete of it", func() {
+		var writtenBefore int
+		Expect(w.RegisterTask(RoutingKeyProductDelete, func(ctx context.Context, msg []byte) error {
+			writtenBefore = len(writes)
+			return nil
+		})).To(Succeed())
+
+		upd, del := &fakeAcknowledger{}, &fakeAcknowledger{}
+		Expect(w.reduce(context.Background(), msg(upd, `[{"shop_item_id": 1}]`))).To(Succeed())
+		Expect(writes).To(BeEmpty())
+
+		delMsg := msg(del, `{"shop_item_ids": [1]}`)
+		delMsg.RoutingKey = RoutingKeyProductDelete
+		Expect(w.reduce(context.Background(), delMsg)).To(Succeed())
+
+		Expect(writtenBefore).To(Equal(1))
+		Expect(upd.acked).To(BeTrue())
+		Expect(del.acked).To(BeTrue())
+	})
+
+	It("writes what is left once consuming stopped", func() {
+		ack := &fakeAcknowledger{}
+		Expect(w.reduce(context.Background(), msg(ack, `[{"shop_item_id": 1}]`))).To(Succeed())
+
+		consumed := make(chan struct{})
+		close(consumed)
+		w.batchers[RoutingKeyProductUpdate].run(consumed)
+		Expect(writes).To(HaveLen(1))
+		Expect(ack.acked).To(BeTrue())
+	})
+})
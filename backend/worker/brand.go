@@ -10,7 +10,7 @@ import (
 )
 
 // CreateOrder creates new order
-func (h *handler) AddBrands(brands []byte) error {
+func (h *handler) AddBrands(ctx context.Context, brands []byte) error {
 	log.Printf("worker.AddBrands started with event:%s payloadL:%s\n", RoutingKeyBrandCreate, brands)
 
 	var brnds []*search.Brand
@@ -19,17 +19,21 @@ func (h *handler) AddBrands(brands []byte) error {
 		return err
 	}
 
-	_, err := h.svc.AddBrands(context.Background(), brnds)
+	res, err := h.svc.AddBrands(ctx, brnds)
 	if err != nil {
 		fmt.Println("worker.AddBrands service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.AddBrands documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyBrandCreate, res)
+	}
 
 	return nil
 }
 
 // UpdateBrands updates brands
-func (h *handler) UpdateBrands(brands []byte) error {
+func (h *handler) UpdateBrands(ctx context.Context, brands []byte) error {
 	log.Printf("worker.UpdateBrands started with event:%s payloadL:%s\n", RoutingKeyBrandUpdate, brands)
 
 	var brnds []*search.Brand
@@ -38,22 +42,29 @@ func (h *handler) UpdateBrands(brands []byte) error {
 		return err
 	}
 
-	_, err := h.svc.UpdateBrands(context.Background(), brnds)
+	res, err := h.svc.UpdateBrands(ctx, brnds)
 	if err != nil {
 		fmt.Println("worker.AddBrands service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.UpdateBrands documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyBrandUpdate, res)
+	}
+	if len(res.Tasks) > 0 {
+		log.Printf("worker.UpdateBrands cascading renames into products as tasks: %v\n", res.Tasks)
+	}
 
 	return nil
 }
 
 // DeleteBrandsReq ...
 type DeleteBrandsReq struct {
-	IDS []int64 `json:"slugs"`
+	IDS []int64 `json:"ids"`
 }
 
 // DeleteBrands creates new order
-func (h *handler) DeleteBrands(brandSlugs []byte) error {
+func (h *handler) DeleteBrands(ctx context.Context, brandSlugs []byte) error {
 	log.Printf("worker.DeleteBrands started with event:%s payloadL:%s\n", RoutingKeyBrandDelete, brandSlugs)
 
 	var brndIDS *DeleteBrandsReq
@@ -62,11 +73,30 @@ func (h *handler) DeleteBrands(brandSlugs []byte) error {
 		return err
 	}
 
-	err := h.svc.DeleteBrands(context.Background(), brndIDS.IDS)
+	res, err := h.svc.DeleteBrands(ctx, brndIDS.IDS)
 	if err != nil {
 		fmt.Println("worker.DeleteBrands service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.DeleteBrands documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyBrandDelete, res)
+	}
 
 	return nil
 }
+
+// brandID is the id a brand is written under
+func brandID(b *search.Brand) int64 {
+	return b.ID
+}
+
+// AddBrandsBatch adds the brands of several messages in one bulk request
+func (h *handler) AddBrandsBatch(ctx context.Context, brands []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "AddBrandsBatch", brands, brandID, h.svc.AddBrands)
+}
+
+// UpdateBrandsBatch updates the brands of several messages in one bulk request
+func (h *handler) UpdateBrandsBatch(ctx context.Context, brands []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "UpdateBrandsBatch", brands, brandID, h.svc.UpdateBrands)
+}
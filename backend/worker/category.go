@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
+)
+
+// AddCategories adds categories
+func (h *handler) AddCategories(ctx context.Context, categories []byte) error {
+	log.Printf("worker.AddCategories started with event:%s payloadL:%s\n", RoutingKeyCategoryCreate, categories)
+
+	var ctgrs []*search.Category
+	if err := json.Unmarshal(categories, &ctgrs); err != nil {
+		fmt.Println("worker.AddCategories couldn't unmarshal msg payload", err)
+		return err
+	}
+
+	res, err := h.svc.AddCategories(ctx, ctgrs)
+	if err != nil {
+		fmt.Println("worker.AddCategories service error:", err)
+		return err
+	}
+	if res.HasFailures() {
+		fmt.Println("worker.AddCategories documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyCategoryCreate, res)
+	}
+
+	return nil
+}
+
+// UpdateCategories updates categories
+func (h *handler) UpdateCategories(ctx context.Context, categories []byte) error {
+	log.Printf("worker.UpdateCategories started with event:%s payloadL:%s\n", RoutingKeyCategoryUpdate, categories)
+
+	var ctgrs []*search.Category
+	if err := json.Unmarshal(categories, &ctgrs); err != nil {
+		fmt.Println("worker.UpdateCategories couldn't unmarshal msg payload", err)
+		return err
+	}
+
+	res, err := h.svc.UpdateCategories(ctx, ctgrs)
+	if err != nil {
+		fmt.Println("worker.UpdateCategories service error:", err)
+		return err
+	}
+	if res.HasFailures() {
+		fmt.Println("worker.UpdateCategories documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyCategoryUpdate, res)
+	}
+
+	return nil
+}
+
+// DeleteCategoriesReq ...
+type DeleteCategoriesReq struct {
+	IDS []int64 `json:"ids"`
+}
+
+// DeleteCategories deletes categories
+func (h *handler) DeleteCategories(ctx context.Context, categoryIDS []byte) error {
+	log.Printf("worker.DeleteCategories started with event:%s payloadL:%s\n", RoutingKeyCategoryDelete, categoryIDS)
+
+	var ctgrIDS *DeleteCategoriesReq
+	if err := json.Unmarshal(categoryIDS, &ctgrIDS); err != nil {
+		fmt.Println("worker.DeleteCategories couldn't unmarshal msg payload", err)
+		return err
+	}
+
+	res, err := h.svc.DeleteCategories(ctx, ctgrIDS.IDS)
+	if err != nil {
+		fmt.Println("worker.DeleteCategories service error:", err)
+		return err
+	}
+	if res.HasFailures() {
+		fmt.Println("worker.DeleteCategories documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyCategoryDelete, res)
+	}
+
+	return nil
+}
+
+// categoryID is the id a category is written under
+func categoryID(c *search.Category) int64 {
+	return c.ID
+}
+
+// AddCategoriesBatch adds the categories of several messages in one bulk request
+func (h *handler) AddCategoriesBatch(ctx context.Context, categories []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "AddCategoriesBatch", categories, categoryID, h.svc.AddCategories)
+}
+
+// UpdateCategoriesBatch updates the categories of several messages in one bulk request
+func (h *handler) UpdateCategoriesBatch(ctx context.Context, categories []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "UpdateCategoriesBatch", categories, categoryID, h.svc.UpdateCategories)
+}
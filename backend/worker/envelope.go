@@ -0,0 +1,115 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxClockSkew is how far in the future an event may be stamped
+const maxClockSkew = 5 * time.Minute
+
+// Envelope defines a catalog event, the payload is read as the schema
+// version of the event type says
+type Envelope struct {
+	EventID       string          `json:"event_id"`
+	EventType     string          `json:"event_type"`
+	SchemaVersion int             `json:"schema_version"`
+	Producer      string          `json:"producer"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// ValidationError defines a message that can't be handled however often it
+// is retried, it is dead lettered right away
+type ValidationError struct {
+	EventID string
+	Errors  []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid event %q: %s", e.EventID, strings.Join(e.Errors, "; "))
+}
+
+// isEnvelope reports whether body is an envelope rather than a bare payload
+func isEnvelope(body []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return false
+	}
+	_, ok := fields["event_type"]
+
+	return ok
+}
+
+// decodeEnvelope decodes and validates the message published with
+// routingKey and upgrades its payload to the latest schema version of its
+// event type. A bare payload, as published before envelopes, is read as
+// version 1 of the event type of its routing key.
+func decodeEnvelope(routingKey string, body []byte, now time.Time) (*Envelope, error) {
+	env := &Envelope{EventType: routingKey, SchemaVersion: 1, Payload: body}
+	errs := []string{}
+
+	if isEnvelope(body) {
+		env = &Envelope{}
+		if err := json.Unmarshal(body, env); err != nil {
+			return nil, &ValidationError{Errors: []string{fmt.Sprintf("malformed envelope: %s", err)}}
+		}
+		errs = env.validate(routingKey, now)
+	} else if !json.Valid(body) {
+		return nil, &ValidationError{Errors: []string{"malformed payload"}}
+	}
+
+	s, ok := schemas[env.EventType][env.SchemaVersion]
+	if !ok {
+		errs = append(errs, fmt.Sprintf("unsupported schema version %d of event type %q", env.SchemaVersion, env.EventType))
+	} else {
+		errs = append(errs, s.validate(env.Payload)...)
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{EventID: env.EventID, Errors: errs}
+	}
+
+	if s.upgrade != nil {
+		payload, err := s.upgrade(env.Payload)
+		if err != nil {
+			return nil, &ValidationError{EventID: env.EventID, Errors: []string{err.Error()}}
+		}
+		env.Payload = payload
+	}
+
+	return env, nil
+}
+
+// validate returns what is wrong with the envelope fields
+func (e *Envelope) validate(routingKey string, now time.Time) []string {
+	errs := []string{}
+	if e.EventID == "" {
+		errs = append(errs, "missing event_id")
+	}
+	if e.EventType != routingKey {
+		errs = append(errs, fmt.Sprintf("event_type %q doesn't match routing key %q", e.EventType, routingKey))
+	}
+	if e.SchemaVersion < 1 {
+		errs = append(errs, "missing schema_version")
+	}
+	if e.Producer == "" {
+		errs = append(errs, "missing producer")
+	}
+	if e.Timestamp.IsZero() {
+		errs = append(errs, "missing timestamp")
+	} else if e.Timestamp.After(now.Add(maxClockSkew)) {
+		errs = append(errs, fmt.Sprintf("timestamp %s is in the future", e.Timestamp.Format(time.RFC3339)))
+	}
+	if len(e.Payload) == 0 {
+		errs = append(errs, "missing payload")
+	}
+
+	return errs
+}
@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/streadway/amqp"
+)
+
+var _ = Describe("Envelope", func() {
+	now := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	envelope := func(eventType string, version int, payload string) []byte {
+		b, err := json.Marshal(map[string]interface{}{
+			"event_id":       "e1",
+			"event_type":     eventType,
+			"schema_version": version,
+			"producer":       "catalog",
+			"timestamp":      now,
+			"payload":        json.RawMessage(payload),
+		})
+		Expect(err).ToNot(HaveOccurred())
+		return b
+	}
+
+	It("decodes a valid envelope", func() {
+		env, err := decodeEnvelope(RoutingKeyProductUpdate, envelope(RoutingKeyProductUpdate, 1, `[{"shop_item_id": 7}]`), now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.EventID).To(Equal("e1"))
+		Expect(env.Producer).To(Equal("catalog"))
+		Expect(string(env.Payload)).To(Equal(`[{"shop_item_id":7}]`))
+	})
+
+	It("upgrades older payload versions to the latest", func() {
+		Expect(SchemaVersions(RoutingKeyBrandDelete)).To(Equal([]int{1, 2}))
+
+		v1, err := decodeEnvelope(RoutingKeyBrandDelete, envelope(RoutingKeyBrandDelete, 1, `{"slugs": [3, 4]}`), now)
+		Expect(err).ToNot(HaveOccurred())
+		v2, err := decodeEnvelope(RoutingKeyBrandDelete, envelope(RoutingKeyBrandDelete, 2, `{"ids": [3, 4]}`), now)
+		Expect(err).ToNot(HaveOccurred())
+
+		var req1, req2 DeleteBrandsReq
+		Expect(json.Unmarshal(v1.Payload, &req1)).To(Succeed())
+		Expect(json.Unmarshal(v2.Payload, &req2)).To(Succeed())
+		Expect(req1.IDS).To(Equal([]int64{3, 4}))
+		Expect(req2).To(Equal(req1))
+	})
+
+	It("reads a bare payload as version 1 of its routing key", func() {
+		env, err := decodeEnvelope(RoutingKeyBrandDelete, []byte(`{"slugs": [3]}`), now)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(env.SchemaVersion).To(Equal(1))
+		Expect(string(env.Payload)).To(Equal(`{"ids":[3]}`))
+	})
+
+	It("reports every validation error", func() {
+		body := []byte(`{"event_type": "catalog.product.update", "schema_version": 1, "timestamp": "2021-03-02T12:00:00Z", "payload": [{"name": "tv"}]}`)
+		_, err := decodeEnvelope(RoutingKeyProductUpdate, body, now)
+
+		var verr *ValidationError
+		Expect(errors.As(err, &verr)).To(BeTrue())
+		Expect(verr.Errors).To(ConsistOf(
+			"missing event_id",
+			"missing producer",
+			"timestamp 2021-03-02T12:00:00Z is in the future",
+			"document #0: missing or invalid shop_item_id",
+		))
+
+		_, err = decodeEnvelope(RoutingKeyShopDelete, envelope(RoutingKeyShopDelete, 3, `{"ids": [1]}`), now)
+		Expect(err).To(MatchError(ContainSubstring("unsupported schema version 3")))
+
+		_, err = decodeEnvelope(RoutingKeyShopDelete, envelope(RoutingKeyBrandDelete, 2, `{"ids": [1]}`), now)
+		Expect(err).To(MatchError(ContainSubstring("doesn't match routing key")))
+	})
+
+	It("dead letters poison messages without retrying them", func() {
+		dly, dl, ack := &fakePublisher{}, &fakePublisher{}, &fakeAcknowledger{}
+		w := NewWorker(1, 0, nil, Retry{Policy: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second}, Queue: "search", Delay: dly, DeadLetter: dl})
+		called := false
+		Expect(w.RegisterTask(RoutingKeyShopDelete, func(ctx context.Context, msg []byte) error {
+			called = true
+			return nil
+		})).To(Succeed())
+
+		Expect(w.reduce(context.Background(), amqp.Delivery{Acknowledger: ack, RoutingKey: RoutingKeyShopDelete, Body: []byte(`{"ids": "1"}`)})).To(Succeed())
+		Expect(called).To(BeFalse())
+		Expect(dly.keys).To(BeEmpty())
+		Expect(dl.keys).To(Equal([]string{RoutingKeyShopDelete}))
+		Expect(dl.headers[0][HeaderError]).To(ContainSubstring("ids must be a non empty array of ids"))
+		Expect(ack.acked).To(BeTrue())
+	})
+})
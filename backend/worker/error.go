@@ -1,10 +1,22 @@
 package worker
 
 import (
+	"errors"
 	"fmt"
+
+	"github.com/BackAged/go-elasticsearch-react/backend/search"
 )
 
+// ErrInvalidDocument is the error of a batched document that can't be
+// decoded, retrying its message never helps
+var ErrInvalidDocument = errors.New("invalid document")
+
 // NewErrAlreadyRegisteredTask returns error
 func NewErrAlreadyRegisteredTask(task string) error {
 	return fmt.Errorf("task-%s already registered", task)
 }
+
+// NewErrPartialBulk returns error for a task whose bulk request failed for some documents
+func NewErrPartialBulk(task string, res *search.BulkResult) error {
+	return fmt.Errorf("task-%s failed for %d documents", task, len(res.Failed))
+}
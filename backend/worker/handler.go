@@ -1,20 +1,34 @@
 package worker
 
 import (
+	"context"
+	"encoding/json"
+
 	"github.com/BackAged/go-elasticsearch-react/backend/search"
 )
 
 // Handler defines handler interface
 type Handler interface {
-	AddBrands(brands []byte) error
-	DeleteBrands(brandSlugs []byte) error
-	UpdateBrands(brands []byte) error
-	AddShops(shops []byte) error
-	DeleteShops(shopSlugs []byte) error
-	UpdateShops(shops []byte) error
-	AddProducts(products []byte) error
-	DeleteProducts(productSlugs []byte) error
-	UpdateProducts(products []byte) error
+	AddBrands(ctx context.Context, brands []byte) error
+	DeleteBrands(ctx context.Context, brandSlugs []byte) error
+	UpdateBrands(ctx context.Context, brands []byte) error
+	AddShops(ctx context.Context, shops []byte) error
+	DeleteShops(ctx context.Context, shopSlugs []byte) error
+	UpdateShops(ctx context.Context, shops []byte) error
+	AddProducts(ctx context.Context, products []byte) error
+	DeleteProducts(ctx context.Context, productSlugs []byte) error
+	UpdateProducts(ctx context.Context, products []byte) error
+	AddCategories(ctx context.Context, categories []byte) error
+	DeleteCategories(ctx context.Context, categoryIDS []byte) error
+	UpdateCategories(ctx context.Context, categories []byte) error
+	AddBrandsBatch(ctx context.Context, brands []json.RawMessage) ([]error, error)
+	UpdateBrandsBatch(ctx context.Context, brands []json.RawMessage) ([]error, error)
+	AddShopsBatch(ctx context.Context, shops []json.RawMessage) ([]error, error)
+	UpdateShopsBatch(ctx context.Context, shops []json.RawMessage) ([]error, error)
+	AddProductsBatch(ctx context.Context, products []json.RawMessage) ([]error, error)
+	UpdateProductsBatch(ctx context.Context, products []json.RawMessage) ([]error, error)
+	AddCategoriesBatch(ctx context.Context, categories []json.RawMessage) ([]error, error)
+	UpdateCategoriesBatch(ctx context.Context, categories []json.RawMessage) ([]error, error)
 }
 
 type handler struct {
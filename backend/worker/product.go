@@ -10,7 +10,7 @@ import (
 )
 
 // AddProducts creates new product
-func (h *handler) AddProducts(products []byte) error {
+func (h *handler) AddProducts(ctx context.Context, products []byte) error {
 	log.Printf("worker.AddProducts started with event:%s payloadL:%s\n", RoutingKeyProductCreate, products)
 
 	var prds []*search.Product
@@ -19,17 +19,21 @@ func (h *handler) AddProducts(products []byte) error {
 		return err
 	}
 
-	_, err := h.svc.AddProducts(context.Background(), prds)
+	res, err := h.svc.AddProducts(ctx, prds)
 	if err != nil {
 		fmt.Println("worker.AddProducts service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.AddProducts documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyProductCreate, res)
+	}
 
 	return nil
 }
 
 // UpdateProducts updates products
-func (h *handler) UpdateProducts(products []byte) error {
+func (h *handler) UpdateProducts(ctx context.Context, products []byte) error {
 	log.Printf("worker.UpdateProducts started with event:%s payloadL:%s\n", RoutingKeyProductUpdate, products)
 
 	var prds []*search.Product
@@ -38,11 +42,15 @@ func (h *handler) UpdateProducts(products []byte) error {
 		return err
 	}
 
-	_, err := h.svc.UpdateProducts(context.Background(), prds)
+	res, err := h.svc.UpdateProducts(ctx, prds)
 	if err != nil {
 		fmt.Println("worker.UpdateProducts service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.UpdateProducts documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyProductUpdate, res)
+	}
 
 	return nil
 }
@@ -53,7 +61,7 @@ type DeleteProductReq struct {
 }
 
 // DeleteProducts delete shops
-func (h *handler) DeleteProducts(productSlugs []byte) error {
+func (h *handler) DeleteProducts(ctx context.Context, productSlugs []byte) error {
 	log.Printf("worker.DeleteProducts started with event:%s payloadL:%s\n", RoutingKeyProductCreate, productSlugs)
 
 	var prdSlgs *DeleteProductReq
@@ -62,11 +70,30 @@ func (h *handler) DeleteProducts(productSlugs []byte) error {
 		return err
 	}
 
-	err := h.svc.DeleteProducts(context.Background(), prdSlgs.ShopItemIDS)
+	res, err := h.svc.DeleteProducts(ctx, prdSlgs.ShopItemIDS)
 	if err != nil {
 		fmt.Println("worker.DeleteShops service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.DeleteProducts documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyProductDelete, res)
+	}
 
 	return nil
 }
+
+// productID is the id a product is written under
+func productID(p *search.Product) int64 {
+	return p.ShopItemID
+}
+
+// AddProductsBatch adds the products of several messages in one bulk request
+func (h *handler) AddProductsBatch(ctx context.Context, products []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "AddProductsBatch", products, productID, h.svc.AddProducts)
+}
+
+// UpdateProductsBatch updates the products of several messages in one bulk request
+func (h *handler) UpdateProductsBatch(ctx context.Context, products []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "UpdateProductsBatch", products, productID, h.svc.UpdateProducts)
+}
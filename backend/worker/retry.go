@@ -0,0 +1,253 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/BackAged/steadyrabbit"
+	"github.com/streadway/amqp"
+)
+
+// headers a retried or dead lettered message carries
+const (
+	// HeaderAttempt counts the attempts that failed so far
+	HeaderAttempt = "x-attempt"
+	// HeaderRoutingKey is the routing key the message was first published
+	// with, delay queues route it back to the worker queue by queue name
+	HeaderRoutingKey = "x-routing-key"
+	// HeaderError is the error of the last failed attempt
+	HeaderError = "x-error"
+	// HeaderFailedAt is when the last attempt failed
+	HeaderFailedAt = "x-failed-at"
+)
+
+// RetryPolicy defines how often and how late a failed message is retried
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts before a message is dead lettered
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it doubles with every
+	// further retry up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay returns how long a message waits before its attempt-th retry
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return d
+}
+
+// Delays returns the distinct retry delays of the policy, in order
+func (p RetryPolicy) Delays() []time.Duration {
+	ds := []time.Duration{}
+	for a := 1; a < p.MaxAttempts; a++ {
+		d := p.Delay(a)
+		if len(ds) == 0 || ds[len(ds)-1] != d {
+			ds = append(ds, d)
+		}
+	}
+
+	return ds
+}
+
+// RetryQueueName is the name of the queue delaying retries of queue by delay.
+// The delay is part of the name, as the ttl of an existing queue can't change.
+func RetryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, delay.Milliseconds())
+}
+
+// DeadLetterExchangeName is the name of the exchange messages of queue are
+// dead lettered to
+func DeadLetterExchangeName(queue string) string {
+	return queue + ".dlx"
+}
+
+// DeadLetterQueueName is the name of the queue keeping the dead letters of queue
+func DeadLetterQueueName(queue string) string {
+	return queue + ".dlq"
+}
+
+// DeclareRetryTopology declares the delay queues of policy, which route
+// expired messages back to queue, and the dead letter exchange and queue
+func DeclareRetryTopology(ch *amqp.Channel, queue string, policy RetryPolicy) error {
+	for _, d := range policy.Delays() {
+		if _, err := ch.QueueDeclare(RetryQueueName(queue, d), true, false, false, false, amqp.Table{
+			"x-message-ttl":             d.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		}); err != nil {
+			return fmt.Errorf("unable to declare retry queue: %w", err)
+		}
+	}
+
+	dlx, dlq := DeadLetterExchangeName(queue), DeadLetterQueueName(queue)
+	if err := ch.ExchangeDeclare(dlx, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("unable to declare dead letter exchange: %w", err)
+	}
+	if _, err := ch.QueueDeclare(dlq, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("unable to declare dead letter queue: %w", err)
+	}
+	if err := ch.QueueBind(dlq, "#", dlx, false, nil); err != nil {
+		return fmt.Errorf("unable to bind dead letter queue: %w", err)
+	}
+
+	return nil
+}
+
+// Publisher defines a message publisher
+type Publisher interface {
+	Publish(ctx context.Context, routingKey string, body []byte, opts ...steadyrabbit.PublishingOption) error
+}
+
+// Retry defines how the worker retries and dead letters failed messages
+type Retry struct {
+	Policy RetryPolicy
+	// Queue is the worker queue retried messages return to
+	Queue string
+	// Delay publishes to the default exchange, DeadLetter to the dead
+	// letter exchange of Queue
+	Delay      Publisher
+	DeadLetter Publisher
+}
+
+// withHeaders sets the headers of a publishing
+func withHeaders(h amqp.Table) steadyrabbit.PublishingOption {
+	return func(ap *amqp.Publishing) {
+		ap.Headers = h
+	}
+}
+
+// routingKey returns the routing key msg was first published with
+func routingKey(msg amqp.Delivery) string {
+	if rk, ok := msg.Headers[HeaderRoutingKey].(string); ok && rk != "" {
+		return rk
+	}
+
+	return msg.RoutingKey
+}
+
+// attempts returns the number of attempts of msg that failed so far
+func attempts(msg amqp.Delivery) int {
+	switch a := msg.Headers[HeaderAttempt].(type) {
+	case int32:
+		return int(a)
+	case int64:
+		return int(a)
+	case int:
+		return a
+	}
+
+	return 0
+}
+
+// failureHeaders returns the headers of msg recording its attempt-th
+// attempt failed with cause
+func failureHeaders(msg amqp.Delivery, attempt int, cause error) amqp.Table {
+	h := amqp.Table{}
+	for k, v := range msg.Headers {
+		h[k] = v
+	}
+	h[HeaderAttempt] = int32(attempt)
+	h[HeaderRoutingKey] = routingKey(msg)
+	h[HeaderError] = cause.Error()
+	h[HeaderFailedAt] = time.Now().UTC().Format(time.RFC3339)
+
+	return h
+}
+
+// retry publishes msg, which failed with cause, to the delay queue of its
+// next attempt or to the dead letter exchange once it ran out of attempts,
+// and acks it. msg is requeued when it can't be published.
+func (w *Worker) retry(ctx context.Context, msg amqp.Delivery, cause error) error {
+	attempt := attempts(msg) + 1
+	if attempt >= w.rtry.Policy.MaxAttempts {
+		log.Printf("task-%s failed %d times, dead lettering: %s\n", routingKey(msg), attempt, cause)
+		return w.publishFailure(ctx, msg, w.rtry.DeadLetter, routingKey(msg), failureHeaders(msg, attempt, cause))
+	}
+
+	d := w.rtry.Policy.Delay(attempt)
+	log.Printf("task-%s failed on attempt %d, retrying in %s: %s\n", routingKey(msg), attempt, d, cause)
+	return w.publishFailure(ctx, msg, w.rtry.Delay, RetryQueueName(w.rtry.Queue, d), failureHeaders(msg, attempt, cause))
+}
+
+// deadLetter publishes msg, which can't ever be handled because of cause,
+// to the dead letter exchange without retrying it and acks it
+func (w *Worker) deadLetter(ctx context.Context, msg amqp.Delivery, cause error) error {
+	log.Printf("task-%s is poison, dead lettering: %s\n", routingKey(msg), cause)
+	return w.publishFailure(ctx, msg, w.rtry.DeadLetter, routingKey(msg), failureHeaders(msg, attempts(msg)+1, cause))
+}
+
+// publishFailure publishes msg with the failure headers h through p and acks
+// it, msg is requeued when it can't be published
+func (w *Worker) publishFailure(ctx context.Context, msg amqp.Delivery, p Publisher, key string, h amqp.Table) error {
+	if err := p.Publish(ctx, key, msg.Body, withHeaders(h)); err != nil {
+		log.Printf("task-%s couldn't be retried, requeueing: %s\n", routingKey(msg), err)
+		return msg.Nack(false, true)
+	}
+
+	return msg.Ack(false)
+}
+
+// ReplayDeadLetters moves up to limit dead letters of queue, every dead
+// letter there is when limit is 0, back to queue with a fresh set of
+// attempts. It returns the number of messages replayed.
+func ReplayDeadLetters(ch *amqp.Channel, queue string, limit int) (int, error) {
+	dlq := DeadLetterQueueName(queue)
+	q, err := ch.QueueInspect(dlq)
+	if err != nil {
+		return 0, fmt.Errorf("unable to inspect dead letter queue: %w", err)
+	}
+
+	// only the dead letters there now, a replayed message failing again
+	// isn't replayed twice
+	n := q.Messages
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	for i := 0; i < n; i++ {
+		msg, ok, err := ch.Get(dlq, false)
+		if err != nil {
+			return i, err
+		}
+		if !ok {
+			return i, nil
+		}
+
+		h := amqp.Table{}
+		for k, v := range msg.Headers {
+			h[k] = v
+		}
+		h[HeaderRoutingKey] = routingKey(msg)
+		delete(h, HeaderAttempt)
+		delete(h, HeaderError)
+		delete(h, HeaderFailedAt)
+
+		if err := ch.Publish("", queue, false, false, amqp.Publishing{
+			Headers:      h,
+			ContentType:  msg.ContentType,
+			DeliveryMode: amqp.Persistent,
+			Body:         msg.Body,
+		}); err != nil {
+			msg.Nack(false, true)
+			return i, err
+		}
+		if err := msg.Ack(false); err != nil {
+			return i + 1, err
+		}
+	}
+
+	return n, nil
+}
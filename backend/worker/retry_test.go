@@ -0,0 +1,112 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BackAged/steadyrabbit"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/streadway/amqp"
+)
+
+// fakePublisher records the messages published
+type fakePublisher struct {
+	keys    []string
+	headers []amqp.Table
+	err     error
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, routingKey string, body []byte, opts ...steadyrabbit.PublishingOption) error {
+	ap := amqp.Publishing{}
+	for _, opt := range opts {
+		opt(&ap)
+	}
+	p.keys = append(p.keys, routingKey)
+	p.headers = append(p.headers, ap.Headers)
+
+	return p.err
+}
+
+// fakeAcknowledger records how a delivery was settled
+type fakeAcknowledger struct {
+	acked, nacked, requeued bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+// brands is a valid payload of a brand create
+const brands = `[{"id": 1, "slug": "walton"}]`
+
+var _ = Describe("Retry", func() {
+	var (
+		dly, dl *fakePublisher
+		ack     *fakeAcknowledger
+		w       *Worker
+		calls   []string
+	)
+
+	plcy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+
+	BeforeEach(func() {
+		dly, dl, ack, calls = &fakePublisher{}, &fakePublisher{}, &fakeAcknowledger{}, nil
+		w = NewWorker(1, 0, nil, Retry{Policy: plcy, Queue: "search", Delay: dly, DeadLetter: dl})
+		Expect(w.RegisterTask(RoutingKeyBrandCreate, func(ctx context.Context, msg []byte) error {
+			calls = append(calls, string(msg))
+			return errors.New("es down")
+		})).To(Succeed())
+	})
+
+	It("backs off exponentially up to the max delay", func() {
+		Expect(plcy.Delay(1)).To(Equal(time.Second))
+		Expect(plcy.Delay(2)).To(Equal(2 * time.Second))
+		Expect(plcy.Delay(5)).To(Equal(3 * time.Second))
+		Expect(RetryPolicy{MaxAttempts: 6, BaseDelay: time.Second, MaxDelay: 3 * time.Second}.Delays()).
+			To(Equal([]time.Duration{time.Second, 2 * time.Second, 3 * time.Second}))
+	})
+
+	It("retries a failed message through the delay queue of its attempt", func() {
+		Expect(w.reduce(context.Background(), amqp.Delivery{Acknowledger: ack, RoutingKey: RoutingKeyBrandCreate, Body: []byte(brands)})).To(Succeed())
+		Expect(ack.acked).To(BeTrue())
+		Expect(dly.keys).To(Equal([]string{"search.retry.1000ms"}))
+		Expect(dly.headers[0][HeaderAttempt]).To(Equal(int32(1)))
+		Expect(dly.headers[0][HeaderRoutingKey]).To(Equal(RoutingKeyBrandCreate))
+		Expect(dly.headers[0][HeaderError]).To(Equal("es down"))
+		Expect(dl.keys).To(BeEmpty())
+	})
+
+	It("dead letters a message out of attempts", func() {
+		msg := amqp.Delivery{
+			Acknowledger: ack,
+			RoutingKey:   "search",
+			Headers:      amqp.Table{HeaderAttempt: int32(2), HeaderRoutingKey: RoutingKeyBrandCreate},
+			Body:         []byte(brands),
+		}
+		Expect(w.reduce(context.Background(), msg)).To(Succeed())
+		Expect(calls).To(Equal([]string{brands}))
+		Expect(dl.keys).To(Equal([]string{RoutingKeyBrandCreate}))
+		Expect(dl.headers[0][HeaderAttempt]).To(Equal(int32(3)))
+		Expect(dly.keys).To(BeEmpty())
+		Expect(ack.acked).To(BeTrue())
+	})
+
+	It("requeues a message it can't retry", func() {
+		dly.err = errors.New("channel closed")
+		Expect(w.reduce(context.Background(), amqp.Delivery{Acknowledger: ack, RoutingKey: RoutingKeyBrandCreate, Body: []byte(brands)})).To(Succeed())
+		Expect(ack.acked).To(BeFalse())
+		Expect(ack.requeued).To(BeTrue())
+	})
+})
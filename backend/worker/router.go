@@ -11,6 +11,10 @@ const (
 	RoutingKeyProductCreate = "catalog.product.create"
 	RoutingKeyProductDelete = "catalog.product.delete"
 	RoutingKeyProductUpdate = "catalog.product.update"
+
+	RoutingKeyCategoryCreate = "catalog.category.create"
+	RoutingKeyCategoryDelete = "catalog.category.delete"
+	RoutingKeyCategoryUpdate = "catalog.category.update"
 )
 
 // RoutingKeys ...
@@ -19,11 +23,13 @@ func RoutingKeys() []string {
 		RoutingKeyBrandCreate, RoutingKeyBrandDelete, RoutingKeyBrandUpdate,
 		RoutingKeyProductCreate, RoutingKeyProductDelete, RoutingKeyProductUpdate,
 		RoutingKeyShopCreate, RoutingKeyShopDelete, RoutingKeyShopdUpdate,
+		RoutingKeyCategoryCreate, RoutingKeyCategoryDelete, RoutingKeyCategoryUpdate,
 	}
 }
 
-// SetUpRouter ...
-func (w *Worker) SetUpRouter(h Handler) error {
+// SetUpRouter registers the task of every routing key, creates and updates
+// are batched as batch defines unless it is disabled
+func (w *Worker) SetUpRouter(h Handler, batch BatchConfig) error {
 	if err := w.RegisterTask(RoutingKeyBrandCreate, h.AddBrands); err != nil {
 		return err
 	}
@@ -51,6 +57,35 @@ func (w *Worker) SetUpRouter(h Handler) error {
 	if err := w.RegisterTask(RoutingKeyProductUpdate, h.UpdateProducts); err != nil {
 		return err
 	}
+	if err := w.RegisterTask(RoutingKeyCategoryCreate, h.AddCategories); err != nil {
+		return err
+	}
+	if err := w.RegisterTask(RoutingKeyCategoryDelete, h.DeleteCategories); err != nil {
+		return err
+	}
+	if err := w.RegisterTask(RoutingKeyCategoryUpdate, h.UpdateCategories); err != nil {
+		return err
+	}
+
+	if !batch.Enabled() {
+		return nil
+	}
+
+	batchTasks := map[string]BatchTaskFunc{
+		RoutingKeyBrandCreate:    h.AddBrandsBatch,
+		RoutingKeyBrandUpdate:    h.UpdateBrandsBatch,
+		RoutingKeyShopCreate:     h.AddShopsBatch,
+		RoutingKeyShopdUpdate:    h.UpdateShopsBatch,
+		RoutingKeyProductCreate:  h.AddProductsBatch,
+		RoutingKeyProductUpdate:  h.UpdateProductsBatch,
+		RoutingKeyCategoryCreate: h.AddCategoriesBatch,
+		RoutingKeyCategoryUpdate: h.UpdateCategoriesBatch,
+	}
+	for task, fn := range batchTasks {
+		if err := w.RegisterBatchTask(task, fn, batch); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
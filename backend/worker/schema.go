@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// schema is a payload version of an event type, validate returns what is
+// wrong with a payload and upgrade, if any, turns a valid payload into the
+// payload of the latest version the tasks take
+type schema struct {
+	validate func(payload json.RawMessage) []string
+	upgrade  func(payload json.RawMessage) (json.RawMessage, error)
+}
+
+// schemas are the payload versions every event type supports side by side.
+// A change of a payload is added as the next version upgrading the previous
+// ones, so producers can move to it one at a time.
+var schemas = map[string]map[int]schema{
+	RoutingKeyBrandCreate: {1: {validate: validateDocs("id")}},
+	RoutingKeyBrandUpdate: {1: {validate: validateDocs("id")}},
+	RoutingKeyBrandDelete: {
+		// version 1 carried the brand ids under slugs
+		1: {validate: validateIDs("slugs"), upgrade: renameField("slugs", "ids")},
+		2: {validate: validateIDs("ids")},
+	},
+	RoutingKeyShopCreate:     {1: {validate: validateDocs("id")}},
+	RoutingKeyShopdUpdate:    {1: {validate: validateDocs("id")}},
+	RoutingKeyShopDelete:     {1: {validate: validateIDs("ids")}},
+	RoutingKeyProductCreate:  {1: {validate: validateDocs("shop_item_id")}},
+	RoutingKeyProductUpdate:  {1: {validate: validateDocs("shop_item_id")}},
+	RoutingKeyProductDelete:  {1: {validate: validateIDs("shop_item_ids")}},
+	RoutingKeyCategoryCreate: {1: {validate: validateDocs("id")}},
+	RoutingKeyCategoryUpdate: {1: {validate: validateDocs("id")}},
+	RoutingKeyCategoryDelete: {1: {validate: validateIDs("ids")}},
+}
+
+// SchemaVersions returns the payload versions eventType supports, in order
+func SchemaVersions(eventType string) []int {
+	vs := []int{}
+	for v := range schemas[eventType] {
+		vs = append(vs, v)
+	}
+	sort.Ints(vs)
+
+	return vs
+}
+
+// validateDocs validates a payload of documents, each identified by a
+// positive idField
+func validateDocs(idField string) func(payload json.RawMessage) []string {
+	return func(payload json.RawMessage) []string {
+		var docs []map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &docs); err != nil {
+			return []string{"payload must be an array of documents"}
+		}
+
+		errs := []string{}
+		for i, d := range docs {
+			var id int64
+			if err := json.Unmarshal(d[idField], &id); err != nil || id <= 0 {
+				errs = append(errs, fmt.Sprintf("document #%d: missing or invalid %s", i, idField))
+			}
+		}
+
+		return errs
+	}
+}
+
+// validateIDs validates a payload holding positive ids under field
+func validateIDs(field string) func(payload json.RawMessage) []string {
+	return func(payload json.RawMessage) []string {
+		var req map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return []string{"payload must be an object"}
+		}
+
+		var ids []int64
+		if err := json.Unmarshal(req[field], &ids); err != nil || len(ids) == 0 {
+			return []string{fmt.Sprintf("%s must be a non empty array of ids", field)}
+		}
+
+		errs := []string{}
+		for i, id := range ids {
+			if id <= 0 {
+				errs = append(errs, fmt.Sprintf("%s #%d: invalid id %d", field, i, id))
+			}
+		}
+
+		return errs
+	}
+}
+
+// renameField upgrades a payload by moving the value of from to to
+func renameField(from string, to string) func(payload json.RawMessage) (json.RawMessage, error) {
+	return func(payload json.RawMessage) (json.RawMessage, error) {
+		var req map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return nil, err
+		}
+		req[to] = req[from]
+		delete(req, from)
+
+		return json.Marshal(req)
+	}
+}
@@ -10,7 +10,7 @@ import (
 )
 
 // AddShops creates new shop
-func (h *handler) AddShops(shops []byte) error {
+func (h *handler) AddShops(ctx context.Context, shops []byte) error {
 	log.Printf("worker.AddShops started with event:%s payloadL:%s\n", RoutingKeyShopCreate, shops)
 
 	var shps []*search.Shop
@@ -19,17 +19,21 @@ func (h *handler) AddShops(shops []byte) error {
 		return err
 	}
 
-	_, err := h.svc.AddShops(context.Background(), shps)
+	res, err := h.svc.AddShops(ctx, shps)
 	if err != nil {
 		fmt.Println("worker.AddShops service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.AddShops documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyShopCreate, res)
+	}
 
 	return nil
 }
 
 // UpdateShops updates shops
-func (h *handler) UpdateShops(shops []byte) error {
+func (h *handler) UpdateShops(ctx context.Context, shops []byte) error {
 	log.Printf("worker.UpdateShops started with event:%s payloadL:%s\n", RoutingKeyShopdUpdate, shops)
 
 	var shps []*search.Shop
@@ -38,11 +42,18 @@ func (h *handler) UpdateShops(shops []byte) error {
 		return err
 	}
 
-	_, err := h.svc.UpdateShops(context.Background(), shps)
+	res, err := h.svc.UpdateShops(ctx, shps)
 	if err != nil {
 		fmt.Println("worker.UpdateShops service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.UpdateShops documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyShopdUpdate, res)
+	}
+	if len(res.Tasks) > 0 {
+		log.Printf("worker.UpdateShops cascading renames into products as tasks: %v\n", res.Tasks)
+	}
 
 	return nil
 }
@@ -53,7 +64,7 @@ type DeleteShopReq struct {
 }
 
 // DeleteShops delete shops
-func (h *handler) DeleteShops(shopSlugs []byte) error {
+func (h *handler) DeleteShops(ctx context.Context, shopSlugs []byte) error {
 	log.Printf("worker.DeleteShops started with event:%s payloadL:%s\n", RoutingKeyShopDelete, shopSlugs)
 
 	var shpSlgs *DeleteShopReq
@@ -62,11 +73,30 @@ func (h *handler) DeleteShops(shopSlugs []byte) error {
 		return err
 	}
 
-	err := h.svc.DeleteShops(context.Background(), shpSlgs.IDS)
+	res, err := h.svc.DeleteShops(ctx, shpSlgs.IDS)
 	if err != nil {
 		fmt.Println("worker.DeleteShops service error:", err)
 		return err
 	}
+	if res.HasFailures() {
+		fmt.Println("worker.DeleteShops documents failed:", res.Failed)
+		return NewErrPartialBulk(RoutingKeyShopDelete, res)
+	}
 
 	return nil
 }
+
+// shopID is the id a shop is written under
+func shopID(s *search.Shop) int64 {
+	return s.ID
+}
+
+// AddShopsBatch adds the shops of several messages in one bulk request
+func (h *handler) AddShopsBatch(ctx context.Context, shops []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "AddShopsBatch", shops, shopID, h.svc.AddShops)
+}
+
+// UpdateShopsBatch updates the shops of several messages in one bulk request
+func (h *handler) UpdateShopsBatch(ctx context.Context, shops []json.RawMessage) ([]error, error) {
+	return writeBatch(ctx, "UpdateShopsBatch", shops, shopID, h.svc.UpdateShops)
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/streadway/amqp"
+)
+
+var _ = Describe("Stop", func() {
+	var (
+		w       *Worker
+		ack     *fakeAcknowledger
+		release chan struct{}
+	)
+
+	// runTask runs a task the way Start does, it blocks until released or aborted
+	runTask := func() {
+		w.running.Add(1)
+		go func() {
+			defer w.running.Done()
+			w.reduce(w.taskCtx, amqp.Delivery{Acknowledger: ack, RoutingKey: RoutingKeyBrandCreate, Body: []byte(brands)})
+		}()
+	}
+
+	BeforeEach(func() {
+		ack, release = &fakeAcknowledger{}, make(chan struct{})
+		w = NewWorker(1, 0, nil, Retry{Policy: RetryPolicy{MaxAttempts: 1}, Delay: &fakePublisher{}, DeadLetter: &fakePublisher{}})
+		Expect(w.RegisterTask(RoutingKeyBrandCreate, func(ctx context.Context, msg []byte) error {
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})).To(Succeed())
+	})
+
+	It("waits for the running tasks", func() {
+		runTask()
+		time.AfterFunc(10*time.Millisecond, func() { close(release) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		Expect(w.Stop(ctx)).To(Succeed())
+		Expect(ack.acked).To(BeTrue())
+	})
+
+	It("aborts the tasks still running after the timeout", func() {
+		runTask()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(w.Stop(ctx)).To(MatchError(context.DeadlineExceeded))
+		Eventually(w.taskCtx.Done()).Should(BeClosed())
+	})
+
+	It("aborts the tasks a running stop waits for when stopped again", func() {
+		runTask()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		graceful := make(chan error, 1)
+		go func() { graceful <- w.Stop(ctx) }()
+
+		forced, abort := context.WithCancel(context.Background())
+		abort()
+		Expect(w.Stop(forced)).To(MatchError(context.Canceled))
+		Eventually(graceful).Should(Receive(Succeed()))
+		Expect(w.taskCtx.Err()).To(MatchError(context.Canceled))
+	})
+
+	It("counts the consumers running a task", func() {
+		Expect(w.Stats()).To(Equal(Stats{Consumers: 1, Idle: 1}))
+		runTask()
+		Eventually(w.Stats).Should(Equal(Stats{Consumers: 1, Active: 1}))
+		close(release)
+		Eventually(w.Stats).Should(Equal(Stats{Consumers: 1, Idle: 1}))
+	})
+
+	It("cancels a task running longer than the task timeout", func() {
+		w.taskTimeout = 10 * time.Millisecond
+		runTask()
+		w.running.Wait()
+		Expect(ack.acked).To(BeTrue())
+		Expect(w.taskCtx.Err()).ToNot(HaveOccurred())
+	})
+})
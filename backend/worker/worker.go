@@ -4,68 +4,118 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/BackAged/steadyrabbit"
 	"github.com/streadway/amqp"
 )
 
+// closedDeliveryBackoff is how long a consumer waits for the consumer to
+// reconnect after its delivery channel closed
+const closedDeliveryBackoff = time.Second
+
 // Worker defines worker
 type Worker struct {
 	taskMap     map[string]TaskFunc
+	batchers    map[string]*batcher
 	concurrency int
-	buffChan    chan struct{}
+	taskTimeout time.Duration
 	consumer    *steadyrabbit.Consumer
+	rtry        Retry
+
+	// tasks run with taskCtx rather than the context consuming stops with,
+	// so stopping doesn't abort running bulk writes
+	taskCtx    context.Context
+	abortTasks context.CancelFunc
+	running    sync.WaitGroup
+	active     int64
+
+	mu            sync.Mutex
+	stopConsuming context.CancelFunc
+	stopped       chan struct{}
+
+	// a forced stop can overlap a graceful one, the consumer is closed once
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Stats defines the load of the consumers of a worker
+type Stats struct {
+	Consumers int `json:"consumers"`
+	Active    int `json:"active"`
+	Idle      int `json:"idle"`
 }
 
-// NewWorker returns a worker
-func NewWorker(concurrency int, consumer *steadyrabbit.Consumer) *Worker {
+// NewWorker returns a worker running concurrency consumers, each task
+// canceled after taskTimeout unless it is 0, and retrying failed messages as
+// rtry defines. Consumers beyond the prefetch count of consumer would never
+// get a message, so concurrency is capped by it.
+func NewWorker(concurrency int, taskTimeout time.Duration, consumer *steadyrabbit.Consumer, rtry Retry) *Worker {
+	if consumer != nil && consumer.Config.Consumer != nil {
+		if pf := consumer.Config.Consumer.QosPrefetchCount; pf > 0 && pf < concurrency {
+			log.Printf("capping worker concurrency %d to the prefetch count %d\n", concurrency, pf)
+			concurrency = pf
+		}
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
 	w := &Worker{
 		taskMap:     make(map[string]TaskFunc, 0),
+		batchers:    make(map[string]*batcher, 0),
 		concurrency: concurrency,
+		taskTimeout: taskTimeout,
 		consumer:    consumer,
+		rtry:        rtry,
 	}
-
-	bc := make(chan struct{}, concurrency)
-	for i := 0; i < concurrency; i++ {
-		bc <- struct{}{}
-	}
-
-	w.buffChan = bc
+	w.taskCtx, w.abortTasks = context.WithCancel(context.Background())
 
 	return w
 }
 
-func (w *Worker) dispatch(taskExecutor TaskFunc, msg amqp.Delivery, errchan chan error) chan error {
-	errchan <- taskExecutor(msg.Body)
+func (w *Worker) reduce(ctx context.Context, msg amqp.Delivery) error {
+	env, err := decodeEnvelope(routingKey(msg), msg.Body, time.Now())
+	if err != nil {
+		return w.deadLetter(ctx, msg, err)
+	}
+	if env.EventID != "" {
+		log.Printf("received event %s of %s v%d from %s\n", env.EventID, env.EventType, env.SchemaVersion, env.Producer)
+	}
 
-	return errchan
-}
+	if b, ok := w.batchers[env.EventType]; ok {
+		return b.add(msg, env.Payload)
+	}
 
-func (w *Worker) reduce(msg amqp.Delivery) error {
-	taskExecutor, ok := w.taskMap[msg.RoutingKey]
+	taskExecutor, ok := w.taskMap[env.EventType]
 	if !ok {
-		fmt.Println(msg)
-		log.Printf("received task-%s not registered!!\n", msg.RoutingKey)
-		return msg.Ack(false)
+		log.Printf("received task-%s not registered!!\n", env.EventType)
+		return w.deadLetter(ctx, msg, fmt.Errorf("task-%s not registered", env.EventType))
 	}
 
-	errChan := make(chan error, 0)
+	// a delete must not overtake the creates and updates batched before it
+	w.flushEntity(env.EventType)
 
-	go w.dispatch(taskExecutor, msg, errChan)
+	atomic.AddInt64(&w.active, 1)
+	defer atomic.AddInt64(&w.active, -1)
 
-	err := <-errChan
+	tctx, cancel := ctx, context.CancelFunc(func() {})
+	if w.taskTimeout > 0 {
+		tctx, cancel = context.WithTimeout(ctx, w.taskTimeout)
+	}
+	err = taskExecutor(tctx, env.Payload)
+	cancel()
 	if err != nil {
-		if msg.Redelivered {
-			return msg.Nack(false, false)
-		}
-		return msg.Nack(false, true)
+		return w.retry(ctx, msg, err)
 	}
 
 	return msg.Ack(false)
 }
 
 // TaskFunc defines task executor
-type TaskFunc func(msg []byte) error
+type TaskFunc func(ctx context.Context, msg []byte) error
 
 // RegisterTask registers a task
 func (w *Worker) RegisterTask(task string, taskExecutor TaskFunc) error {
@@ -78,19 +128,126 @@ func (w *Worker) RegisterTask(task string, taskExecutor TaskFunc) error {
 	return nil
 }
 
-// ConsumeNewMessage ...
-func (w *Worker) ConsumeNewMessage() {
-	if err := w.consumer.ConsumeOne(context.Background(), w.reduce); err != nil {
+// ConsumeNewMessage waits for a message until ctx is done and runs its task,
+// it returns false when the delivery channel was closed
+func (w *Worker) ConsumeNewMessage(ctx context.Context) bool {
+	open := true
+	reduce := func(msg amqp.Delivery) error {
+		// a closed delivery channel hands out zero deliveries
+		if msg.Acknowledger == nil {
+			open = false
+			return nil
+		}
+		return w.reduce(w.taskCtx, msg)
+	}
+
+	if err := w.consumer.ConsumeOne(ctx, reduce); err != nil {
 		log.Printf("error consuming new message: %s\n", err)
 	}
+
+	return open
+}
+
+// consume consumes messages one after the other until ctx is done
+func (w *Worker) consume(ctx context.Context) {
+	for ctx.Err() == nil {
+		if w.ConsumeNewMessage(ctx) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(closedDeliveryBackoff):
+		}
+	}
+}
+
+// Start runs the consumers of the worker until ctx is done or Stop is called
+func (w *Worker) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	w.mu.Lock()
+	w.stopConsuming, w.stopped = cancel, stopped
+	w.mu.Unlock()
+	defer close(stopped)
+	defer cancel()
+
+	log.Printf("started worker with %d consumers...\n", w.concurrency)
+	var consumers sync.WaitGroup
+	consumers.Add(w.concurrency)
+	w.running.Add(w.concurrency)
+	for i := 0; i < w.concurrency; i++ {
+		go func() {
+			defer w.running.Done()
+			defer consumers.Done()
+			w.consume(ctx)
+		}()
+	}
+
+	// batches are written a last time once no consumer adds to them
+	consumed := make(chan struct{})
+	go func() {
+		consumers.Wait()
+		close(consumed)
+	}()
+	w.running.Add(len(w.batchers))
+	for _, b := range w.batchers {
+		go func(b *batcher) {
+			defer w.running.Done()
+			b.run(consumed)
+		}(b)
+	}
+
+	<-ctx.Done()
+	log.Println("worker stopped consuming")
+
+	return nil
+}
+
+// Stats returns how many consumers are running a task and how many wait
+// for a message
+func (w *Worker) Stats() Stats {
+	active := int(atomic.LoadInt64(&w.active))
+
+	return Stats{Consumers: w.concurrency, Active: active, Idle: w.concurrency - active}
 }
 
-// Start starts the worker
-func (w *Worker) Start() error {
-	log.Println("started worker...")
-	for {
-		<-w.buffChan
-		go w.ConsumeNewMessage()
-		w.buffChan <- struct{}{}
+// Stop stops consuming, waits for the running tasks until ctx is done and
+// closes the consumer. Tasks still running then are aborted, RabbitMQ
+// redelivers their messages as they are never acked. Stop may be called
+// again while it runs, with a done ctx to abort the tasks it waits for.
+func (w *Worker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	stopConsuming, stopped := w.stopConsuming, w.stopped
+	w.mu.Unlock()
+	if stopConsuming != nil {
+		stopConsuming()
+		<-stopped
 	}
+
+	done := make(chan struct{})
+	go func() {
+		w.running.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		log.Println("worker drained running tasks")
+	case <-ctx.Done():
+		w.abortTasks()
+		err = fmt.Errorf("worker stopped with tasks still running: %w", ctx.Err())
+	}
+
+	w.closeOnce.Do(func() {
+		if w.consumer != nil {
+			w.closeErr = w.consumer.Close()
+		}
+	})
+	if w.closeErr != nil && err == nil {
+		err = w.closeErr
+	}
+
+	return err
 }
@@ -32,28 +32,39 @@ var _ = Describe("Worker", func() {
 			p, err := steadyrabbit.NewPublisher(cnf)
 			Expect(err).ToNot(HaveOccurred())
 
-			b := []byte(`[
-				{
-					"slug": "shahin3",
-					"name": "aha",
-					"image_url": "aha.coom"
-				},
-				{
-					"slug": "shahin4",
-					"name": "aha",
-					"image_url": "aha.coom"
-				},
-				{
-					"slug": "shahin5",
-					"name": "aha",
-					"image_url": "aha.coom"
-				},
-				{
-					"slug": "shahin6",
-					"name": "aha",
-					"image_url": "aha.coom"
-				}
-			]`)
+			b := []byte(`{
+				"event_id": "0b7c6a1e-3f4d-4c2b-9a57-6f1d2e8c9b10",
+				"event_type": "catalog.brand.create",
+				"schema_version": 1,
+				"producer": "catalog",
+				"timestamp": "2021-03-01T12:00:00Z",
+				"payload": [
+					{
+						"id": 3,
+						"slug": "shahin3",
+						"name": "aha",
+						"image_url": "aha.coom"
+					},
+					{
+						"id": 4,
+						"slug": "shahin4",
+						"name": "aha",
+						"image_url": "aha.coom"
+					},
+					{
+						"id": 5,
+						"slug": "shahin5",
+						"name": "aha",
+						"image_url": "aha.coom"
+					},
+					{
+						"id": 6,
+						"slug": "shahin6",
+						"name": "aha",
+						"image_url": "aha.coom"
+					}
+				]
+			}`)
 
 			err = p.Publish(context.Background(), tName, b)
 			Expect(err).ToNot(HaveOccurred())